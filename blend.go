@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// blendFile is a minimal reader for Blender's .blend format. It only knows
+// how to find blocks and read struct fields by name using the file's own
+// struct definitions (SDNA), so it keeps working as long as Blender doesn't
+// rename the fields this tool uses.
+type blendFile struct {
+	order   binary.ByteOrder
+	ptrSize int
+	version int
+
+	blocks []*blendBlock
+	byAddr map[uint64]*blendBlock
+
+	structs  map[string]*dnaStruct
+	bySDNA   []*dnaStruct
+	typeSize map[string]int
+}
+
+type blendBlock struct {
+	code  string
+	addr  uint64
+	sdna  int
+	count int
+	data  []byte
+}
+
+type dnaStruct struct {
+	name   string
+	size   int
+	fields map[string]dnaField
+}
+
+type dnaField struct {
+	typ     string
+	offset  int
+	size    int
+	pointer bool
+}
+
+// a view of one struct in a block
+type blendStruct struct {
+	file *blendFile
+	typ  *dnaStruct
+	data []byte
+}
+
+func readBlend(name string) (*blendFile, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blender can save compressed files, which are otherwise unchanged
+	switch {
+	case bytes.HasPrefix(b, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		d, err := zstd.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		b, err = io.ReadAll(d)
+		d.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		b, err = io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	f, err := parseBlend(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return f, nil
+}
+
+func parseBlend(b []byte) (*blendFile, error) {
+	// BLENDER, then the pointer size, the byte order, and a three digit version
+	if len(b) < 12 || string(b[:7]) != "BLENDER" {
+		return nil, errors.New("not a .blend file")
+	}
+
+	f := &blendFile{
+		byAddr:   make(map[uint64]*blendBlock),
+		structs:  make(map[string]*dnaStruct),
+		typeSize: make(map[string]int),
+	}
+
+	switch b[7] {
+	case '_':
+		f.ptrSize = 4
+	case '-':
+		f.ptrSize = 8
+	default:
+		return nil, fmt.Errorf("unsupported .blend header %q (saved by a newer version of Blender?)", b[:12])
+	}
+
+	switch b[8] {
+	case 'v':
+		f.order = binary.LittleEndian
+	case 'V':
+		f.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unsupported .blend header %q", b[:12])
+	}
+
+	var err error
+	f.version, err = strconv.Atoi(string(b[9:12]))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported .blend header %q", b[:12])
+	}
+
+	headerSize := 16 + f.ptrSize
+	var dna []byte
+	for pos := 12; ; {
+		if pos+headerSize > len(b) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		h := b[pos : pos+headerSize]
+		block := &blendBlock{
+			code:  strings.TrimRight(string(h[:4]), "\x00"),
+			sdna:  int(f.order.Uint32(h[8+f.ptrSize:])),
+			count: int(f.order.Uint32(h[12+f.ptrSize:])),
+		}
+		if f.ptrSize == 8 {
+			block.addr = f.order.Uint64(h[8:])
+		} else {
+			block.addr = uint64(f.order.Uint32(h[8:]))
+		}
+
+		size := int(int32(f.order.Uint32(h[4:])))
+		pos += headerSize
+		if size < 0 || pos+size > len(b) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		block.data = b[pos : pos+size]
+		pos += size
+
+		if block.code == "ENDB" {
+			break
+		}
+		if block.code == "DNA1" {
+			dna = block.data
+			continue
+		}
+
+		f.blocks = append(f.blocks, block)
+		f.byAddr[block.addr] = block
+	}
+
+	if dna == nil {
+		return nil, errors.New("missing struct definitions (DNA1 block)")
+	}
+
+	err = f.parseDNA(dna)
+	if err != nil {
+		return nil, fmt.Errorf("DNA1: %w", err)
+	}
+
+	return f, nil
+}
+
+func (f *blendFile) parseDNA(b []byte) error {
+	pos := 0
+	expect := func(tag string) error {
+		pos = (pos + 3) &^ 3
+		if pos+8 > len(b) || string(b[pos:pos+4]) != tag {
+			return fmt.Errorf("expected %s", tag)
+		}
+		pos += 4
+		return nil
+	}
+	readInt := func(size int) int {
+		if pos+size > len(b) {
+			pos = len(b) + 1
+			return 0
+		}
+		pos += size
+		if size == 2 {
+			return int(f.order.Uint16(b[pos-2:]))
+		}
+		return int(f.order.Uint32(b[pos-4:]))
+	}
+	readStrings := func() ([]string, error) {
+		strs := make([]string, readInt(4))
+		for i := range strs {
+			end := bytes.IndexByte(b[pos:], 0)
+			if end == -1 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			strs[i] = string(b[pos : pos+end])
+			pos += end + 1
+		}
+		return strs, nil
+	}
+
+	if len(b) < 4 || string(b[:4]) != "SDNA" {
+		return errors.New("expected SDNA")
+	}
+	pos = 4
+
+	if err := expect("NAME"); err != nil {
+		return err
+	}
+	names, err := readStrings()
+	if err != nil {
+		return err
+	}
+
+	if err = expect("TYPE"); err != nil {
+		return err
+	}
+	types, err := readStrings()
+	if err != nil {
+		return err
+	}
+
+	if err = expect("TLEN"); err != nil {
+		return err
+	}
+	for _, t := range types {
+		f.typeSize[t] = readInt(2)
+	}
+
+	if err = expect("STRC"); err != nil {
+		return err
+	}
+	f.bySDNA = make([]*dnaStruct, readInt(4))
+	for i := range f.bySDNA {
+		t := readInt(2)
+		if t >= len(types) {
+			return fmt.Errorf("struct %d has invalid type %d", i, t)
+		}
+
+		s := &dnaStruct{
+			name:   types[t],
+			size:   f.typeSize[types[t]],
+			fields: make(map[string]dnaField),
+		}
+
+		offset := 0
+		for j, n := readInt(2), 0; n < j; n++ {
+			ft, fn := readInt(2), readInt(2)
+			if ft >= len(types) || fn >= len(names) {
+				return fmt.Errorf("struct %s has an invalid field", s.name)
+			}
+
+			name, field := f.parseFieldName(names[fn])
+			field.typ = types[ft]
+			field.offset = offset
+			if !field.pointer {
+				field.size *= f.typeSize[field.typ]
+			}
+			offset += field.size
+
+			s.fields[name] = field
+		}
+
+		f.bySDNA[i] = s
+		f.structs[s.name] = s
+	}
+
+	if pos > len(b) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// parseFieldName splits a declaration like "*next", "obmat[4][4]", or
+// "(*func)()" into the field name and its size. For non-pointers, the size
+// is the number of elements.
+func (f *blendFile) parseFieldName(decl string) (string, dnaField) {
+	field := dnaField{size: 1}
+
+	name := decl
+	if i := strings.IndexByte(name, '['); i != -1 {
+		for _, dim := range strings.Split(strings.TrimSuffix(name[i+1:], "]"), "][") {
+			n, _ := strconv.Atoi(dim)
+			field.size *= n
+		}
+		name = name[:i]
+	}
+
+	if strings.HasPrefix(name, "(*") {
+		// function pointer
+		field.pointer = true
+		name = strings.TrimPrefix(name, "(*")
+		name = name[:strings.IndexByte(name, ')')]
+	} else if strings.HasPrefix(name, "*") {
+		field.pointer = true
+		name = strings.TrimLeft(name, "*")
+	}
+
+	if field.pointer {
+		field.size *= f.ptrSize
+	}
+
+	return name, field
+}
+
+// requireFields returns an error if a struct is missing any of the named fields.
+func (f *blendFile) requireFields(structName string, fields ...string) error {
+	s, ok := f.structs[structName]
+	if !ok {
+		return fmt.Errorf("this version of Blender has no %s struct", structName)
+	}
+
+	for _, name := range fields {
+		if _, ok := s.fields[name]; !ok {
+			return fmt.Errorf("this version of Blender has no %s.%s field", structName, name)
+		}
+	}
+
+	return nil
+}
+
+// blocksWithCode returns the first struct in each block with the given code.
+func (f *blendFile) blocksWithCode(code string) []blendStruct {
+	var structs []blendStruct
+	for _, b := range f.blocks {
+		if b.code == code && b.sdna < len(f.bySDNA) {
+			structs = append(structs, blendStruct{f, f.bySDNA[b.sdna], b.data})
+		}
+	}
+
+	return structs
+}
+
+// deref returns the block that starts at the given address.
+func (f *blendFile) deref(addr uint64) (*blendBlock, bool) {
+	if addr == 0 {
+		return nil, false
+	}
+
+	b, ok := f.byAddr[addr]
+	return b, ok
+}
+
+// derefStruct returns a view of the first struct in the block at addr, as the named type.
+func (f *blendFile) derefStruct(addr uint64, typ string) (blendStruct, bool) {
+	b, ok := f.deref(addr)
+	if !ok || len(b.data) < f.structs[typ].size {
+		return blendStruct{}, false
+	}
+
+	return blendStruct{f, f.structs[typ], b.data}, true
+}
+
+func (s blendStruct) field(name string) (dnaField, []byte) {
+	field, ok := s.typ.fields[name]
+	if !ok {
+		panic(fmt.Sprintf("%s has no field named %s", s.typ.name, name))
+	}
+
+	return field, s.data[field.offset : field.offset+field.size]
+}
+
+// str reads a char array as a null-terminated string.
+func (s blendStruct) str(name string) string {
+	_, b := s.field(name)
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+// int reads an integer field of any size.
+func (s blendStruct) int(name string) int64 {
+	field, b := s.field(name)
+	switch s.file.typeSize[field.typ] {
+	case 1:
+		if field.typ == "char" {
+			return int64(int8(b[0]))
+		}
+		return int64(b[0])
+	case 2:
+		if strings.HasPrefix(field.typ, "u") {
+			return int64(s.file.order.Uint16(b))
+		}
+		return int64(int16(s.file.order.Uint16(b)))
+	case 4:
+		if strings.HasPrefix(field.typ, "u") {
+			return int64(s.file.order.Uint32(b))
+		}
+		return int64(int32(s.file.order.Uint32(b)))
+	default:
+		return int64(s.file.order.Uint64(b))
+	}
+}
+
+// floats reads a float field or array.
+func (s blendStruct) floats(name string) []float64 {
+	_, b := s.field(name)
+	return s.file.float32s(b)
+}
+
+func (s blendStruct) ptr(name string) uint64 {
+	_, b := s.field(name)
+	if s.file.ptrSize == 8 {
+		return s.file.order.Uint64(b)
+	}
+
+	return uint64(s.file.order.Uint32(b))
+}
+
+// sub returns a view of an embedded struct.
+func (s blendStruct) sub(name string) blendStruct {
+	field, b := s.field(name)
+	return blendStruct{s.file, s.file.structs[field.typ], b}
+}
+
+func (f *blendFile) float32s(b []byte) []float64 {
+	floats := make([]float64, len(b)/4)
+	for i := range floats {
+		floats[i] = float64(math.Float32frombits(f.order.Uint32(b[i*4:])))
+	}
+
+	return floats
+}
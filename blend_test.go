@@ -0,0 +1,75 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestReadBlendAreaRects(t *testing.T) {
+	if err := loadLayout(); err != nil {
+		t.Fatal(err)
+	}
+
+	rects, err := readBlendAreaRects("mainmenu.blend")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout := make(map[string]image.Rectangle)
+	for sheetIndex := 0; sheetIndex < len(sheets)+len(additiveSheets); sheetIndex++ {
+		ids, areaRects := layoutRects(sheetIndex)
+		for i, id := range ids {
+			layout[id] = *areaRects[i]
+		}
+	}
+
+	for _, tt := range []struct {
+		id   string
+		want image.Rectangle
+	}{
+		{"settings", image.Rect(0, 0, 192, 192)},
+		{"logo", image.Rect(384, 0, 896, 256)},
+		{"top_button_3", image.Rect(2304, 0, 2816, 208)},
+		{"quick_join_2", image.Rect(80, 2280, 1120, 3000)},
+		{"hoiaf_top_10_9", image.Rect(3520, 1440, 5040, 1560)},
+		{"event_timer_1", image.Rect(3440, 1832, 5040, 2032)},
+		{"news", image.Rect(3440, 2472, 5040, 3392)},
+	} {
+		r, ok := rects[tt.id]
+		if !ok {
+			t.Errorf("%s (%q) is not in mainmenu.blend", tt.id, blendObjects[tt.id])
+			continue
+		}
+		if r != tt.want {
+			t.Errorf("%s (%q) is at %v in mainmenu.blend, want %v", tt.id, blendObjects[tt.id], r, tt.want)
+		}
+		if l, ok := layout[tt.id]; !ok {
+			t.Errorf("%s is not in the layout", tt.id)
+		} else if l != r {
+			t.Errorf("%s is %v in the layout, but %v in mainmenu.blend", tt.id, l, r)
+		}
+	}
+}
+
+func TestParseFieldName(t *testing.T) {
+	f := &blendFile{ptrSize: 8}
+
+	for _, tt := range []struct {
+		decl string
+		name string
+		want dnaField
+	}{
+		{"flag", "flag", dnaField{size: 1}},
+		{"*next", "next", dnaField{size: 8, pointer: true}},
+		{"**mat", "mat", dnaField{size: 8, pointer: true}},
+		{"name[64]", "name", dnaField{size: 64}},
+		{"obmat[4][4]", "obmat", dnaField{size: 16}},
+		{"*mtex[18]", "mtex", dnaField{size: 18 * 8, pointer: true}},
+		{"(*func)()", "func", dnaField{size: 8, pointer: true}},
+	} {
+		name, field := f.parseFieldName(tt.decl)
+		if name != tt.name || field != tt.want {
+			t.Errorf("parseFieldName(%q) = %q, %+v; want %q, %+v", tt.decl, name, field, tt.name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"sort"
+)
+
+// the object in mainmenu.blend that each area is rendered from, by area instance ID
+var blendObjects = map[string]string{
+	"settings":       "Settings Button",
+	"notifications":  "Notifications Button",
+	"quit":           "Quit Button",
+	"logo":           "Game Logo",
+	"top_button_1":   "Loadout Button",
+	"top_button_2":   "Contracts Button",
+	"top_button_3":   "Recordings Button",
+	"top_button_4":   "Swarmopedia Button",
+	"top_button_5":   "Inventory Button",
+	"profile":        "Commander Mini-Profile",
+	"create_lobby":   "Create Lobby",
+	"singleplayer":   "Singleplayer",
+	"quick_join_1":   "Public Lobbies",
+	"quick_join_2":   "Friends Playing",
+	"workshop":       "Popular Workshop Items",
+	"hoiaf_top_1":    "HoIAF Top 1",
+	"hoiaf_top_10_1": "HoIAF Top 2",
+	"hoiaf_top_10_2": "HoIAF Top 3",
+	"hoiaf_top_10_3": "HoIAF Top 4",
+	"hoiaf_top_10_4": "HoIAF Top 5",
+	"hoiaf_top_10_5": "HoIAF Top 6",
+	"hoiaf_top_10_6": "HoIAF Top 7",
+	"hoiaf_top_10_7": "HoIAF Top 8",
+	"hoiaf_top_10_8": "HoIAF Top 9",
+	"hoiaf_top_10_9": "HoIAF Top 10",
+	"hoiaf_timer":    "HoIAF Season Timer",
+	// the event timers are numbered from the bottom in Blender
+	"event_timer_1": "Event Timer 3",
+	"event_timer_2": "Event Timer 2",
+	"event_timer_3": "Event Timer 1",
+	"news":          "News Showcase",
+	"update":        "Latest Update",
+}
+
+// Blender object, camera, and sensor fit types
+const (
+	blendObjectMesh   = 1
+	blendObjectCamera = 11
+
+	blendCameraPersp = 0
+	blendCameraOrtho = 1
+
+	blendSensorFitAuto = 0
+	blendSensorFitHor  = 1
+	blendSensorFitVert = 2
+)
+
+// blendProjection converts world coordinates to render pixels the same way the scene's camera does.
+type blendProjection struct {
+	// world to camera space
+	view [4][4]float64
+
+	ortho bool
+	// world units (at a distance of 1 for perspective cameras) per pixel
+	pixelSize float64
+	aspect    float64
+	width     float64
+	height    float64
+	shiftX    float64
+	shiftY    float64
+}
+
+// readBlendAreaRects returns the bounding box, in render pixels, of the
+// object for each area listed in blendObjects. Objects that extend past the
+// edge of the frame are cut off at the edge.
+func readBlendAreaRects(name string) (map[string]image.Rectangle, error) {
+	f, err := readBlend(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, req := range [...]struct {
+		structName string
+		fields     []string
+	}{
+		{"ID", []string{"name"}},
+		{"Object", []string{"id", "type", "data", "obmat"}},
+		{"Scene", []string{"camera", "r"}},
+		{"RenderData", []string{"xsch", "ysch", "size", "xasp", "yasp"}},
+		{"Camera", []string{"type", "lens", "ortho_scale", "sensor_x", "sensor_y", "sensor_fit", "shiftx", "shifty"}},
+		{"Mesh", []string{"totvert", "vdata"}},
+		{"CustomData", []string{"layers", "totlayer"}},
+		{"CustomDataLayer", []string{"type", "name", "data"}},
+	} {
+		err = f.requireFields(req.structName, req.fields...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	scenes := f.blocksWithCode("SC")
+	if len(scenes) == 0 {
+		return nil, fmt.Errorf("%s has no scene", name)
+	}
+
+	proj, err := f.cameraProjection(scenes[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	objects := make(map[string]blendStruct)
+	for _, ob := range f.blocksWithCode("OB") {
+		// ID names start with a two letter type code
+		objects[ob.sub("id").str("name")[2:]] = ob
+	}
+
+	ids := make([]string, 0, len(blendObjects))
+	for id := range blendObjects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rects := make(map[string]image.Rectangle, len(ids))
+	for _, id := range ids {
+		ob, ok := objects[blendObjects[id]]
+		if !ok {
+			return nil, fmt.Errorf("%s has no object named %q (for %s)", name, blendObjects[id], id)
+		}
+		if ob.int("type") != blendObjectMesh {
+			return nil, fmt.Errorf("%s: object %q is not a mesh", name, blendObjects[id])
+		}
+
+		mesh, ok := f.derefStruct(ob.ptr("data"), "Mesh")
+		if !ok {
+			return nil, fmt.Errorf("%s: object %q has no mesh data", name, blendObjects[id])
+		}
+
+		positions, err := f.meshPositions(mesh)
+		if err != nil {
+			return nil, fmt.Errorf("%s: object %q: %w", name, blendObjects[id], err)
+		}
+		if len(positions) == 0 {
+			return nil, fmt.Errorf("%s: object %q has no vertices", name, blendObjects[id])
+		}
+
+		world := blendMatrix(ob.floats("obmat"))
+		minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, p := range positions {
+			x, y := proj.project(transformPoint(world, p))
+			minX, minY = math.Min(minX, x), math.Min(minY, y)
+			maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+		}
+
+		rects[id] = image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY))).Intersect(frameBounds)
+	}
+
+	return rects, nil
+}
+
+func (f *blendFile) cameraProjection(scene blendStruct) (*blendProjection, error) {
+	ob, ok := f.derefStruct(scene.ptr("camera"), "Object")
+	if !ok || ob.int("type") != blendObjectCamera {
+		return nil, errors.New("the scene has no camera")
+	}
+
+	cam, ok := f.derefStruct(ob.ptr("data"), "Camera")
+	if !ok {
+		return nil, errors.New("the scene camera has no camera data")
+	}
+
+	r := scene.sub("r")
+	p := &blendProjection{
+		view:   invertAffine(blendMatrix(ob.floats("obmat"))),
+		width:  float64(r.int("xsch")*r.int("size")) / 100,
+		height: float64(r.int("ysch")*r.int("size")) / 100,
+		aspect: r.floats("yasp")[0] / r.floats("xasp")[0],
+	}
+
+	// the frames may have been rendered at a different resolution percentage than the file was saved with
+	if math.Abs(p.width/p.height-float64(frameBounds.Dx())/float64(frameBounds.Dy())) > 1e-6 {
+		return nil, fmt.Errorf("the render size (%gx%g) is not the same shape as the rendered frames (%v)", p.width, p.height, frameBounds.Size())
+	}
+
+	// this follows BKE_camera_params_compute_viewplane
+	fit := cam.int("sensor_fit")
+	sensor := cam.floats("sensor_x")[0]
+	if fit == blendSensorFitVert {
+		sensor = cam.floats("sensor_y")[0]
+	}
+	if fit == blendSensorFitAuto {
+		fit = blendSensorFitHor
+		if r.floats("xasp")[0]*p.width < r.floats("yasp")[0]*p.height {
+			fit = blendSensorFitVert
+		}
+	}
+
+	viewFactor := p.width
+	if fit == blendSensorFitVert {
+		viewFactor = p.aspect * p.height
+	}
+
+	switch cam.int("type") {
+	case blendCameraPersp:
+		p.pixelSize = sensor / cam.floats("lens")[0] / viewFactor
+	case blendCameraOrtho:
+		p.ortho = true
+		p.pixelSize = cam.floats("ortho_scale")[0] / viewFactor
+	default:
+		return nil, errors.New("only perspective and orthographic cameras are supported")
+	}
+
+	p.shiftX = cam.floats("shiftx")[0] * viewFactor
+	p.shiftY = cam.floats("shifty")[0] * viewFactor
+
+	return p, nil
+}
+
+// project returns the position of a point in frame pixels, with y pointing down.
+func (p *blendProjection) project(world [3]float64) (float64, float64) {
+	c := transformPoint(p.view, world)
+	x, y := c[0], c[1]
+	if !p.ortho {
+		// the camera looks down its negative Z axis
+		x, y = x/-c[2], y/-c[2]
+	}
+
+	px := x/p.pixelSize + p.width/2 - p.shiftX
+	py := (y/p.pixelSize + p.aspect*p.height/2 - p.shiftY) / p.aspect
+
+	return px * float64(frameBounds.Dx()) / p.width, (p.height - py) * float64(frameBounds.Dy()) / p.height
+}
+
+// meshPositions returns the positions of a mesh's vertices in object space.
+func (f *blendFile) meshPositions(mesh blendStruct) ([][3]float64, error) {
+	count := int(mesh.int("totvert"))
+	vdata := mesh.sub("vdata")
+
+	layerType := f.structs["CustomDataLayer"]
+	layers, ok := f.deref(vdata.ptr("layers"))
+	if !ok || len(layers.data) < int(vdata.int("totlayer"))*layerType.size {
+		return nil, errors.New("missing vertex data")
+	}
+
+	for i := 0; i < int(vdata.int("totlayer")); i++ {
+		layer := blendStruct{f, layerType, layers.data[i*layerType.size : (i+1)*layerType.size]}
+		data, ok := f.deref(layer.ptr("data"))
+		if !ok {
+			continue
+		}
+
+		// Blender 3.5 and later store positions as a generic attribute; older versions use MVert
+		stride, offset := 0, 0
+		switch {
+		case layer.str("name") == "position":
+			stride = 12
+		case layer.int("type") == 0 && f.structs["MVert"] != nil:
+			stride = f.structs["MVert"].size
+			offset = f.structs["MVert"].fields["co"].offset
+		default:
+			continue
+		}
+
+		if len(data.data) < count*stride {
+			return nil, errors.New("vertex data is too short")
+		}
+
+		positions := make([][3]float64, count)
+		for j := range positions {
+			co := f.float32s(data.data[j*stride+offset : j*stride+offset+12])
+			positions[j] = [3]float64{co[0], co[1], co[2]}
+		}
+
+		return positions, nil
+	}
+
+	return nil, errors.New("no vertex positions")
+}
+
+// blendMatrix converts a Blender float[4][4], which is stored one column at a time.
+func blendMatrix(m []float64) [4][4]float64 {
+	var out [4][4]float64
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			out[row][col] = m[col*4+row]
+		}
+	}
+
+	return out
+}
+
+func transformPoint(m [4][4]float64, p [3]float64) [3]float64 {
+	var out [3]float64
+	for row := 0; row < 3; row++ {
+		out[row] = m[row][0]*p[0] + m[row][1]*p[1] + m[row][2]*p[2] + m[row][3]
+	}
+
+	return out
+}
+
+// invertAffine inverts a matrix whose last row is 0, 0, 0, 1.
+func invertAffine(m [4][4]float64) [4][4]float64 {
+	a, b, c := m[0][0], m[0][1], m[0][2]
+	d, e, f := m[1][0], m[1][1], m[1][2]
+	g, h, i := m[2][0], m[2][1], m[2][2]
+
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	inv := [4][4]float64{
+		{(e*i - f*h) / det, (c*h - b*i) / det, (b*f - c*e) / det, 0},
+		{(f*g - d*i) / det, (a*i - c*g) / det, (c*d - a*f) / det, 0},
+		{(d*h - e*g) / det, (b*g - a*h) / det, (a*e - b*d) / det, 0},
+		{0, 0, 0, 1},
+	}
+
+	for row := 0; row < 3; row++ {
+		inv[row][3] = -(inv[row][0]*m[0][3] + inv[row][1]*m[1][3] + inv[row][2]*m[2][3])
+	}
+
+	return inv
+}
+
+// applyBlendLayout replaces the rectangle of each area listed in blendObjects
+// with the bounds of its object in the .blend file.
+func applyBlendLayout() error {
+	rects, err := readBlendAreaRects(*blendLayout)
+	if err != nil {
+		return err
+	}
+
+	for sheetIndex := 0; sheetIndex < len(sheets)+len(additiveSheets); sheetIndex++ {
+		ids, areaRects := layoutRects(sheetIndex)
+		for i, id := range ids {
+			if r, ok := rects[id]; ok {
+				*areaRects[i] = r
+			}
+		}
+	}
+
+	return nil
+}
+
+// blendCommand reports areas whose rectangles don't match their objects in the .blend file.
+func blendCommand(args []string) {
+	fs := flag.NewFlagSet("blend", flag.ExitOnError)
+	file := fs.String("file", "mainmenu.blend", "Blender file the frames are rendered from")
+	tolerance := fs.Int("tolerance", 0, "number of pixels any edge of an area may be off by before it is reported")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	rects, err := readBlendAreaRects(*file)
+	if err != nil {
+		panic(err)
+	}
+
+	checked, drifted := 0, 0
+	for sheetIndex := 0; sheetIndex < len(sheets)+len(additiveSheets); sheetIndex++ {
+		name, _ := sheetNames(sheetIndex)
+		ids, areaRects := layoutRects(sheetIndex)
+		for i, id := range ids {
+			r, ok := rects[id]
+			if !ok {
+				continue
+			}
+			checked++
+
+			a := *areaRects[i]
+			if absInt(a.Min.X-r.Min.X) <= *tolerance && absInt(a.Min.Y-r.Min.Y) <= *tolerance && absInt(a.Max.X-r.Max.X) <= *tolerance && absInt(a.Max.Y-r.Max.Y) <= *tolerance {
+				continue
+			}
+			drifted++
+
+			fmt.Printf("%s: %s is %v, but %q is at %v\n", name, id, a, blendObjects[id], r)
+			fmt.Printf("\timage.Rect(%d, %d, %d, %d),\n", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+		}
+	}
+
+	fmt.Printf("%d areas checked against %s\n", checked, *file)
+	if drifted != 0 {
+		fmt.Printf("%d areas have drifted\n", drifted)
+		os.Exit(1)
+	}
+}
+
+func absInt(i int) int {
+	if i < 0 {
+		return -i
+	}
+
+	return i
+}
+
+// readBlendMarkers returns the frame of each timeline marker in the first scene.
+func readBlendMarkers(name string) (map[string]int, error) {
+	f, err := readBlend(name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.requireFields("Scene", "markers")
+	if err == nil {
+		err = f.requireFields("ListBase", "first")
+	}
+	if err == nil {
+		err = f.requireFields("TimeMarker", "next", "frame", "name")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	scenes := f.blocksWithCode("SC")
+	if len(scenes) == 0 {
+		return nil, fmt.Errorf("%s has no scene", name)
+	}
+
+	addr := scenes[0].sub("markers").ptr("first")
+
+	markers := make(map[string]int)
+	for addr != 0 {
+		m, ok := f.derefStruct(addr, "TimeMarker")
+		if !ok {
+			return nil, fmt.Errorf("%s: timeline marker list is broken", name)
+		}
+
+		markerName := m.str("name")
+		if frame, ok := markers[markerName]; ok {
+			return nil, fmt.Errorf("%s: there are two timeline markers named %q (frames %d and %d)", name, markerName, frame, m.int("frame"))
+		}
+		markers[markerName] = int(m.int("frame"))
+
+		addr = m.ptr("next")
+	}
+
+	if len(markers) == 0 {
+		return nil, fmt.Errorf("%s has no timeline markers", name)
+	}
+
+	return markers, nil
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// bump this whenever a change to the code would change the output for the same input
+const cacheVersion = 4
+
+type buildCache struct {
+	Version   int                        `json:"version"`
+	Frames    map[string]frameCacheEntry `json:"frames"`
+	Sheets    map[string]sheetCacheEntry `json:"sheets"`
+	Sequences map[string]seqCacheEntry   `json:"sequences"`
+
+	dir      string
+	disabled bool
+}
+
+type frameCacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+}
+
+type sheetCacheEntry struct {
+	// hash of the layout, settings, and input frame files
+	InputKey string `json:"input_key"`
+	// hash of the layout, settings, and processed sequence pixels
+	ContentKey string `json:"content_key"`
+}
+
+type seqCacheEntry struct {
+	// hash of the sequence definition, settings, and input frame files
+	InputKey string `json:"input_key"`
+	// hash of the unprocessed cropped pixels
+	CropHash string `json:"crop_hash"`
+	// hash of the processed pixels; also the name of the cached image
+	Hash string `json:"hash"`
+}
+
+func loadBuildCache() *buildCache {
+	c := &buildCache{
+		Version:   cacheVersion,
+		Frames:    make(map[string]frameCacheEntry),
+		Sheets:    make(map[string]sheetCacheEntry),
+		Sequences: make(map[string]seqCacheEntry),
+		dir:       outputPath(".sliceanddice-cache"),
+		disabled:  *noCache,
+	}
+
+	if c.disabled {
+		return c
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.dir, "cache.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("ignoring build cache: %v\n", err)
+		}
+
+		return c
+	}
+
+	var loaded buildCache
+	err = json.Unmarshal(b, &loaded)
+	if err != nil || loaded.Version != cacheVersion || loaded.Frames == nil || loaded.Sheets == nil || loaded.Sequences == nil {
+		fmt.Println("ignoring out of date build cache")
+
+		return c
+	}
+
+	c.Frames, c.Sheets, c.Sequences = loaded.Frames, loaded.Sheets, loaded.Sequences
+
+	return c
+}
+
+func (c *buildCache) save() {
+	if c.disabled {
+		return
+	}
+
+	err := os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.WriteFile(filepath.Join(c.dir, "cache.json"), append(b, '\n'), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	// remove cached images that are no longer referenced
+	keep := make(map[string]bool)
+	for _, s := range c.Sequences {
+		keep[s.Hash+".png"] = true
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".png" && !keep[e.Name()] {
+			err = os.Remove(filepath.Join(c.dir, e.Name()))
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// frameHash returns a hash of the contents of the files containing a render
+// frame or glow pass.
+func (c *buildCache) frameHash(rf renderFile) (string, error) {
+	files, err := rf.files()
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 1 {
+		return c.sourceFileHash(files[0])
+	}
+
+	h := sha256.New()
+	for _, file := range files {
+		sum, err := c.sourceFileHash(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", file.path(), sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileHash returns a hash of the contents of a file, re-using the previous
+// hash if the file's size and modification time have not changed.
+func (c *buildCache) fileHash(name string) (string, error) {
+	return c.sourceFileHash(sourceFile{dirSource(""), "", name})
+}
+
+// sourceFileHash is fileHash for a file that might be in an archive.
+func (c *buildCache) sourceFileHash(file sourceFile) (string, error) {
+	name := file.path()
+	fi, err := file.stat()
+	if err != nil {
+		return "", err
+	}
+
+	if e, ok := c.Frames[name]; ok && e.Size == fi.Size() && e.ModTime.Equal(fi.ModTime()) {
+		return e.Hash, nil
+	}
+
+	f, err := file.open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	c.Frames[name] = frameCacheEntry{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		Hash:    sum,
+	}
+
+	return sum, nil
+}
+
+// settingsKey writes everything other than the layout and the input files that can change the output.
+func settingsKey(h hash.Hash) {
+	fmt.Fprintf(h, "version=%d dither=%v\n", cacheVersion, dither)
+	if usesEXR() {
+		fmt.Fprintf(h, "exposure=%v tonemap=%v layer=%q glow-layer=%q\n", *exposure, tonemap, *exrLayer, *glowLayer)
+	}
+	if denoise != denoiseNone || *noiseFloor != 0 {
+		fmt.Fprintf(h, "denoise=%v radius=%d range=%v noise-floor=%v\n", denoise, *denoiseRadius, *denoiseRange, *noiseFloor)
+	}
+}
+
+func sheetLayoutKey(h hash.Hash, sheetIndex int) {
+	if sheetIndex < len(sheets) {
+		fmt.Fprintf(h, "%v\n", sheets[sheetIndex])
+	} else {
+		fmt.Fprintf(h, "%v\n", additiveSheets[sheetIndex-len(sheets)])
+	}
+
+	// the order of the sequences also depends on this
+	names := sheetSequenceNames(sheetIndex)
+	fmt.Fprintf(h, "%v\n", names)
+
+	for _, name := range names {
+		if style, ok := generatedStyle(sheetIndex, name); ok {
+			fmt.Fprintf(h, "generated %s %v\n", name, style)
+		}
+	}
+}
+
+// vtexSettingsKey writes the contents of the settings file vtex reads for a sheet.
+func vtexSettingsKey(h hash.Hash, sheetIndex int) error {
+	name, _ := sheetNames(sheetIndex)
+	b, err := os.ReadFile(name + ".txt")
+	if os.IsNotExist(err) {
+		fmt.Fprintf(h, "no vtex settings\n")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h, "vtex settings %x\n", sha256.Sum256(b))
+
+	return nil
+}
+
+func (c *buildCache) sheetInputKey(sheetIndex int, requested []queuedFrame) (string, error) {
+	h := sha256.New()
+	settingsKey(h)
+	sheetLayoutKey(h, sheetIndex)
+	if err := vtexSettingsKey(h, sheetIndex); err != nil {
+		return "", err
+	}
+
+	files := make(map[renderFile]bool)
+	masked := make(map[string]bool)
+	for _, q := range requested {
+		files[renderFile{q.index, q.glow}] = true
+		if q.area != "" && !masked[q.area] {
+			masked[q.area] = true
+
+			key, err := c.maskKey(q.area)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "mask %s %s\n", q.area, key)
+		}
+	}
+	sorted := make([]renderFile, 0, len(files))
+	for f := range files {
+		sorted = append(sorted, f)
+	}
+	sortRenderFiles(sorted)
+
+	for _, f := range sorted {
+		sum, err := c.frameHash(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d %s\n", f.kind(), f.index, sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sheetContentKey(sheetIndex int, sequences []sequence) (string, error) {
+	h := sha256.New()
+	settingsKey(h)
+	sheetLayoutKey(h, sheetIndex)
+	if err := vtexSettingsKey(h, sheetIndex); err != nil {
+		return "", err
+	}
+
+	for _, s := range sequences {
+		fmt.Fprintf(h, "%s %s\n", s.name, imageHash(s.img))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sheetFresh returns true if the sheet's outputs exist and were built from the same input.
+func (c *buildCache) sheetFresh(sheetIndex int, key func(sheetCacheEntry) string, want string) bool {
+	if c.disabled {
+		return false
+	}
+
+	name, _ := sheetNames(sheetIndex)
+	if e, ok := c.Sheets[name]; !ok || key(e) != want {
+		return false
+	}
+
+	for _, ext := range [...]string{".tga", ".sht", ".vtf", ".h"} {
+		if _, err := os.Stat(outputPath(name + ext)); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *buildCache) sequenceInputKey(sheetIndex int, name string, frames []int, glow bool, maskKey string) (string, error) {
+	h := sha256.New()
+	settingsKey(h)
+	fmt.Fprintf(h, "%s %v mask=%s\n", name, sheetSequenceSources(sheetIndex)[name], maskKey)
+
+	for j, i := range frames {
+		// only an additive sequence's hover frame can be a glow pass
+		f := renderFile{i, glow && j == 1}
+		sum, err := c.frameHash(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d %s\n", f.kind(), i, sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadSequence returns the cached processed image for a sequence, if there is one that matches the given key.
+func (c *buildCache) loadSequence(sheetIndex int, name string, match func(seqCacheEntry) bool) *image.NRGBA {
+	if c.disabled {
+		return nil
+	}
+
+	sheetName, _ := sheetNames(sheetIndex)
+	e, ok := c.Sequences[sheetName+"/"+name]
+	if !ok || !match(e) {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(c.dir, e.Hash+".png"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		// fully opaque images are not stored with an alpha channel
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	if imageHash(nrgba) != e.Hash {
+		return nil
+	}
+
+	return nrgba
+}
+
+func (c *buildCache) storeSequence(sheetIndex int, name string, e seqCacheEntry, img *image.NRGBA) {
+	if c.disabled {
+		return
+	}
+
+	e.Hash = imageHash(img)
+
+	err := os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	cacheName := filepath.Join(c.dir, e.Hash+".png")
+	if _, err = os.Stat(cacheName); os.IsNotExist(err) {
+		out, err := os.Create(cacheName)
+		if err != nil {
+			panic(err)
+		}
+
+		err = (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(out, img)
+		if err != nil {
+			panic(err)
+		}
+
+		err = out.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	sheetName, _ := sheetNames(sheetIndex)
+	c.Sequences[sheetName+"/"+name] = e
+}
+
+// sequenceCropKey identifies a sequence's unprocessed crops along with the
+// settings used to process them.
+func sequenceCropKey(s *sequence) string {
+	h := sha256.New()
+	settingsKey(h)
+	fmt.Fprintf(h, "glow=%v mask=%s generated=%v\n", s.glow, s.maskKey, s.generated)
+
+	key := hex.EncodeToString(h.Sum(nil)) + floatImageHash(s.crop)
+	if s.crop2 != nil {
+		key += floatImageHash(s.crop2)
+	}
+
+	return key
+}
+
+func floatImageHash(img *floatImage) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%v\n", img.Rect.Size())
+	binary.Write(h, binary.LittleEndian, img.Pix)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func imageHash(img *image.NRGBA) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%v\n", img.Rect.Size())
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		h.Write(img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type denoiseMethod int
+
+const (
+	denoiseNone denoiseMethod = iota
+	denoiseMedian
+	denoiseBilateral
+)
+
+func (m denoiseMethod) String() string {
+	switch m {
+	case denoiseNone:
+		return "none"
+	case denoiseMedian:
+		return "median"
+	case denoiseBilateral:
+		return "bilateral"
+	}
+
+	return fmt.Sprintf("denoiseMethod(%d)", int(m))
+}
+
+func (m *denoiseMethod) Set(s string) error {
+	switch s {
+	case "none":
+		*m = denoiseNone
+	case "median":
+		*m = denoiseMedian
+	case "bilateral":
+		*m = denoiseBilateral
+	default:
+		return fmt.Errorf("unknown denoise method %q (expected none, median, or bilateral)", s)
+	}
+
+	return nil
+}
+
+// denoiseDiff filters the color channels of an additive difference image.
+// Alpha is left alone, since it comes from the base frame rather than the
+// difference.
+func denoiseDiff(src *floatImage, method denoiseMethod, radius int) *floatImage {
+	if method == denoiseNone || radius < 1 {
+		return src
+	}
+
+	dst := newFloatImage(src.Rect)
+	copy(dst.Pix, src.Pix)
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	window := make([]float32, 0, (2*radius+1)*(2*radius+1))
+
+	// the spatial weights only depend on the offset
+	spatial := make([]float64, (2*radius+1)*(2*radius+1))
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			d2 := float64(dx*dx + dy*dy)
+			spatial[(dy+radius)*(2*radius+1)+dx+radius] = math.Exp(-d2 / (2 * float64(radius*radius)))
+		}
+	}
+	rangeSigma2 := 2 * *denoiseRange * *denoiseRange
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := (y*w + x) * 4
+			for c := 0; c < 3; c++ {
+				center := src.Pix[i+c]
+
+				var sum, weight float64
+				window = window[:0]
+				for dy := -radius; dy <= radius; dy++ {
+					// the edges are extended
+					yy := clampInt(y+dy, 0, h-1)
+					for dx := -radius; dx <= radius; dx++ {
+						xx := clampInt(x+dx, 0, w-1)
+						v := src.Pix[(yy*w+xx)*4+c]
+
+						if method == denoiseMedian {
+							window = append(window, v)
+							continue
+						}
+
+						d := float64(v - center)
+						wt := spatial[(dy+radius)*(2*radius+1)+dx+radius] * math.Exp(-d*d/rangeSigma2)
+						sum += wt * float64(v)
+						weight += wt
+					}
+				}
+
+				if method == denoiseMedian {
+					sort.Slice(window, func(a, b int) bool { return window[a] < window[b] })
+					dst.Pix[i+c] = window[len(window)/2]
+				} else {
+					dst.Pix[i+c] = float32(sum / weight)
+				}
+			}
+		}
+	}
+
+	return dst
+}
+
+// applyNoiseFloor zeroes color values closer to zero than floor, and returns
+// true if that was all of them.
+func applyNoiseFloor(f *floatImage, floor float64) bool {
+	empty := true
+	for i := 0; i < len(f.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			if math.Abs(float64(f.Pix[i+c])) <= floor {
+				f.Pix[i+c] = 0
+			} else if f.Pix[i+c] > 0 {
+				empty = false
+			}
+		}
+	}
+
+	return empty
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+
+	return v
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+type ditherMethod int
+
+const (
+	ditherNone ditherMethod = iota
+	ditherOrdered
+	ditherFloydSteinberg
+)
+
+func (m ditherMethod) String() string {
+	switch m {
+	case ditherNone:
+		return "none"
+	case ditherOrdered:
+		return "ordered"
+	case ditherFloydSteinberg:
+		return "floyd-steinberg"
+	}
+
+	return fmt.Sprintf("ditherMethod(%d)", int(m))
+}
+
+func (m *ditherMethod) Set(s string) error {
+	switch s {
+	case "none":
+		*m = ditherNone
+	case "ordered", "blue-noise":
+		*m = ditherOrdered
+	case "floyd-steinberg", "fs":
+		*m = ditherFloydSteinberg
+	default:
+		return fmt.Errorf("unknown dither method %q (expected none, ordered, or floyd-steinberg)", s)
+	}
+
+	return nil
+}
+
+// floatImage holds un-quantized pixel values in the range [0, 255], four channels per pixel (R, G, B, A).
+type floatImage struct {
+	Pix  []float32
+	Rect image.Rectangle
+}
+
+func newFloatImage(r image.Rectangle) *floatImage {
+	return &floatImage{
+		Pix:  make([]float32, 4*r.Dx()*r.Dy()),
+		Rect: r,
+	}
+}
+
+func (f *floatImage) offset(x, y int) int {
+	return ((y-f.Rect.Min.Y)*f.Rect.Dx() + (x - f.Rect.Min.X)) * 4
+}
+
+// nrgbaToFloat converts an 8-bit image without changing any of its values.
+func nrgbaToFloat(img *image.NRGBA) *floatImage {
+	f := newFloatImage(img.Rect)
+	i := 0
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for _, v := range img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)] {
+			f.Pix[i] = float32(v)
+			i++
+		}
+	}
+
+	return f
+}
+
+// crop copies part of the image into a new image whose top left corner is (0, 0).
+func (f *floatImage) crop(r image.Rectangle) *floatImage {
+	r = r.Intersect(f.Rect)
+	dst := newFloatImage(r.Sub(r.Min))
+	for y := 0; y < r.Dy(); y++ {
+		o := f.offset(r.Min.X, r.Min.Y+y)
+		copy(dst.Pix[dst.offset(0, y):dst.offset(0, y+1)], f.Pix[o:o+4*r.Dx()])
+	}
+
+	return dst
+}
+
+// quantize converts a floatImage to 8 bits per channel.
+//
+// This is done per sequence, before packing, so the padding gutters only ever
+// contain copies of already-quantized edge pixels. The dither pattern is
+// anchored to the sequence's own origin and does not depend on where it ends
+// up in the atlas, so the output is the same every run.
+func quantize(src *floatImage, method ditherMethod) *image.NRGBA {
+	dst := image.NewNRGBA(src.Rect)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	switch method {
+	case ditherNone:
+		for i, v := range src.Pix {
+			dst.Pix[i] = clampByte(math.Round(float64(v)))
+		}
+	case ditherOrdered:
+		noise := blueNoise()
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := (y*w + x) * 4
+				for c := 0; c < 4; c++ {
+					// offset each channel so they don't share a threshold
+					t := noise[((y+c*23)%blueNoiseSize)*blueNoiseSize+(x+c*41)%blueNoiseSize]
+					dst.Pix[i+c] = clampByte(math.Floor(float64(src.Pix[i+c]) + t))
+				}
+			}
+		}
+	case ditherFloydSteinberg:
+		// work on a copy so the caller's values aren't modified
+		buf := append([]float32(nil), src.Pix...)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := (y*w + x) * 4
+				for c := 0; c < 4; c++ {
+					// additive differences are negative where the hover is darker; that
+					// error can't be shown, so it mustn't be diffused into the neighbors
+					v := min(max(buf[i+c], 0), 255)
+					q := clampByte(math.Round(float64(v)))
+					dst.Pix[i+c] = q
+
+					e := v - float32(q)
+					if x+1 < w {
+						buf[i+4+c] += e * 7 / 16
+					}
+					if y+1 < h {
+						j := i + w*4
+						if x > 0 {
+							buf[j-4+c] += e * 3 / 16
+						}
+						buf[j+c] += e * 5 / 16
+						if x+1 < w {
+							buf[j+4+c] += e * 1 / 16
+						}
+					}
+				}
+			}
+		}
+	default:
+		panic("unhandled dither method: " + method.String())
+	}
+
+	return dst
+}
+
+func clampByte(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+
+	return uint8(v)
+}
+
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce      sync.Once
+	blueNoiseThreshold []float64
+)
+
+// blueNoise returns a blueNoiseSize x blueNoiseSize threshold matrix with values in (0, 1).
+func blueNoise() []float64 {
+	blueNoiseOnce.Do(func() {
+		blueNoiseThreshold = makeBlueNoise()
+	})
+
+	return blueNoiseThreshold
+}
+
+// makeBlueNoise generates the matrix using the void-and-cluster method with a
+// fixed seed, so it is identical on every run.
+func makeBlueNoise() []float64 {
+	const n = blueNoiseSize * blueNoiseSize
+	const sigma = 1.5
+
+	kernel := make([]float64, n)
+	for dy := 0; dy < blueNoiseSize; dy++ {
+		for dx := 0; dx < blueNoiseSize; dx++ {
+			x, y := dx, dy
+			if x > blueNoiseSize/2 {
+				x = blueNoiseSize - x
+			}
+			if y > blueNoiseSize/2 {
+				y = blueNoiseSize - y
+			}
+			kernel[dy*blueNoiseSize+dx] = math.Exp(-float64(x*x+y*y) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(p int, on bool) {
+		pattern[p] = on
+		d := 1.0
+		if !on {
+			d = -1
+		}
+		px, py := p%blueNoiseSize, p/blueNoiseSize
+		for qy := 0; qy < blueNoiseSize; qy++ {
+			ky := ((qy - py + blueNoiseSize) % blueNoiseSize) * blueNoiseSize
+			for qx := 0; qx < blueNoiseSize; qx++ {
+				energy[qy*blueNoiseSize+qx] += d * kernel[ky+(qx-px+blueNoiseSize)%blueNoiseSize]
+			}
+		}
+	}
+	tightestCluster := func() int {
+		best := -1
+		for i, on := range pattern {
+			if on && (best == -1 || energy[i] > energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	largestVoid := func() int {
+		best := -1
+		for i, on := range pattern {
+			if !on && (best == -1 || energy[i] < energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// initial binary pattern
+	rng := rand.New(rand.NewSource(1))
+	ones := n / 10
+	for _, p := range rng.Perm(n)[:ones] {
+		toggle(p, true)
+	}
+	for {
+		cluster := tightestCluster()
+		toggle(cluster, false)
+		void := largestVoid()
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+
+	initial := append([]bool(nil), pattern...)
+	initialEnergy := append([]float64(nil), energy...)
+	rank := make([]int, n)
+
+	// phase 1: rank the initial points by removing the tightest clusters
+	for r := ones - 1; r >= 0; r-- {
+		p := tightestCluster()
+		toggle(p, false)
+		rank[p] = r
+	}
+
+	// phases 2 and 3: fill the largest voids until the matrix is full
+	copy(pattern, initial)
+	copy(energy, initialEnergy)
+	for r := ones; r < n; r++ {
+		p := largestVoid()
+		toggle(p, true)
+		rank[p] = r
+	}
+
+	thresholds := make([]float64, n)
+	for i, r := range rank {
+		thresholds[i] = (float64(r) + 0.5) / n
+	}
+
+	return thresholds
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestQuantizeNegativeDifferences(t *testing.T) {
+	// an additive difference where the first pixel got darker in the hover frame
+	row := []float32{-200, 40, 40, 40}
+	want := []uint8{0, 40, 40, 40}
+
+	for _, method := range []ditherMethod{ditherNone, ditherFloydSteinberg} {
+		f := newFloatImage(image.Rect(0, 0, len(row), 1))
+		for i, v := range row {
+			f.Pix[i*4] = v
+		}
+
+		img := quantize(f, method)
+		for i := range row {
+			if got := img.Pix[i*4]; got != want[i] {
+				t.Errorf("%v: pixel %d is %d, want %d", method, i, got, want[i])
+			}
+		}
+	}
+}
+
+func TestQuantizeOrderedAverage(t *testing.T) {
+	// one whole tile of the threshold matrix, so every threshold is used once per channel
+	rect := image.Rect(0, 0, blueNoiseSize, blueNoiseSize)
+	for _, v := range []float32{0.25, 17.5, 100.3, 254.9} {
+		f := newFloatImage(rect)
+		for i := range f.Pix {
+			f.Pix[i] = v
+		}
+
+		img := quantize(f, ditherOrdered)
+		var sum [4]float64
+		for i, q := range img.Pix {
+			if q != uint8(math.Floor(float64(v))) && q != uint8(math.Ceil(float64(v))) {
+				t.Fatalf("%v: pixel %d channel %d is %d", v, i/4, i%4, q)
+			}
+			sum[i%4] += float64(q)
+		}
+
+		for c, s := range sum {
+			if mean := s / float64(rect.Dx()*rect.Dy()); math.Abs(mean-float64(v)) > 1.0/(blueNoiseSize*blueNoiseSize) {
+				t.Errorf("%v: channel %d averages %v", v, c, mean)
+			}
+		}
+	}
+}
+
+func TestBlueNoiseDeterministic(t *testing.T) {
+	a, b := blueNoise(), makeBlueNoise()
+	if len(a) != blueNoiseSize*blueNoiseSize {
+		t.Fatalf("blue noise has %d thresholds, want %d", len(a), blueNoiseSize*blueNoiseSize)
+	}
+
+	h := sha256.New()
+	seen := make(map[float64]bool)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("threshold %d is %v one time and %v the next", i, a[i], b[i])
+		}
+		if a[i] <= 0 || a[i] >= 1 || seen[a[i]] {
+			t.Errorf("threshold %d is %v, which is out of range or repeated", i, a[i])
+		}
+		seen[a[i]] = true
+		binary.Write(h, binary.LittleEndian, a[i])
+	}
+
+	// changing the matrix changes the output of every ordered build, so it should be on purpose
+	const want = "3f3f9709a26e94c871f1510817d07bd1bf9a0a3ca48dbd556a281b647f58a57c"
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != want {
+		t.Errorf("blue noise hashes to %s, want %s", sum, want)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+// exrImage is a decoded single-part scanline OpenEXR file. Pixels are linear
+// and, as is the convention for OpenEXR, premultiplied by alpha.
+type exrImage struct {
+	Rect image.Rectangle
+	// one slice per channel name, len Rect.Dx()*Rect.Dy()
+	Channels map[string][]float32
+}
+
+type exrChannel struct {
+	name      string
+	pixelType int32
+	xSampling int32
+	ySampling int32
+}
+
+// pixel types
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+// compression methods
+const (
+	exrNoCompression   = 0
+	exrRLECompression  = 1
+	exrZIPSCompression = 2
+	exrZIPCompression  = 3
+	exrPIZCompression  = 4
+)
+
+var exrCompressionNames = [...]string{"none", "RLE", "ZIPS", "ZIP", "PIZ", "PXR24", "B44", "B44A", "DWAA", "DWAB"}
+
+func decodeEXR(b []byte) (*exrImage, error) {
+	if len(b) < 8 || !bytes.Equal(b[:4], []byte{0x76, 0x2f, 0x31, 0x01}) {
+		return nil, errors.New("not an OpenEXR file")
+	}
+
+	version := binary.LittleEndian.Uint32(b[4:])
+	switch {
+	case version&0xff != 2:
+		return nil, fmt.Errorf("unsupported OpenEXR version %d", version&0xff)
+	case version&0x200 != 0:
+		return nil, errors.New("tiled OpenEXR files are not supported")
+	case version&0x800 != 0:
+		return nil, errors.New("deep OpenEXR files are not supported")
+	case version&0x1000 != 0:
+		return nil, errors.New("multi-part OpenEXR files are not supported")
+	}
+
+	var channels []exrChannel
+	var dataWindow image.Rectangle
+	compression := -1
+
+	pos := 8
+	cstring := func() (string, error) {
+		end := bytes.IndexByte(b[pos:], 0)
+		if end == -1 {
+			return "", io.ErrUnexpectedEOF
+		}
+		s := string(b[pos : pos+end])
+		pos += end + 1
+		return s, nil
+	}
+
+	for {
+		attrName, err := cstring()
+		if err != nil {
+			return nil, err
+		}
+		if attrName == "" {
+			break
+		}
+
+		attrType, err := cstring()
+		if err != nil {
+			return nil, err
+		}
+		if pos+4 > len(b) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		size := int(int32(binary.LittleEndian.Uint32(b[pos:])))
+		pos += 4
+		if size < 0 || pos+size > len(b) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		value := b[pos : pos+size]
+		pos += size
+
+		switch {
+		case attrName == "channels" && attrType == "chlist":
+			channels, err = parseEXRChannels(value)
+			if err != nil {
+				return nil, err
+			}
+		case attrName == "compression" && attrType == "compression" && size == 1:
+			compression = int(value[0])
+		case attrName == "dataWindow" && attrType == "box2i" && size == 16:
+			dataWindow = image.Rect(
+				int(int32(binary.LittleEndian.Uint32(value[0:]))),
+				int(int32(binary.LittleEndian.Uint32(value[4:]))),
+				// the maximum is inclusive
+				int(int32(binary.LittleEndian.Uint32(value[8:])))+1,
+				int(int32(binary.LittleEndian.Uint32(value[12:])))+1,
+			)
+		}
+	}
+
+	if channels == nil || compression == -1 || dataWindow.Empty() {
+		return nil, errors.New("missing required header attribute")
+	}
+
+	linesPerChunk := 0
+	switch compression {
+	case exrNoCompression, exrRLECompression, exrZIPSCompression:
+		linesPerChunk = 1
+	case exrZIPCompression:
+		linesPerChunk = 16
+	case exrPIZCompression:
+		linesPerChunk = 32
+	default:
+		method := fmt.Sprint(compression)
+		if compression < len(exrCompressionNames) {
+			method = exrCompressionNames[compression]
+		}
+		return nil, fmt.Errorf("unsupported compression method %s (save as none, ZIP, or PIZ)", method)
+	}
+
+	for _, c := range channels {
+		if c.xSampling != 1 || c.ySampling != 1 {
+			return nil, fmt.Errorf("channel %s is subsampled", c.name)
+		}
+		if c.pixelType < exrUint || c.pixelType > exrFloat {
+			return nil, fmt.Errorf("channel %s has unknown pixel type %d", c.name, c.pixelType)
+		}
+	}
+
+	img := &exrImage{
+		Rect:     dataWindow,
+		Channels: make(map[string][]float32, len(channels)),
+	}
+	width, height := dataWindow.Dx(), dataWindow.Dy()
+	for _, c := range channels {
+		img.Channels[c.name] = make([]float32, width*height)
+	}
+
+	bytesPerLine := 0
+	for _, c := range channels {
+		bytesPerLine += width * exrPixelSize(c.pixelType)
+	}
+
+	chunks := (height + linesPerChunk - 1) / linesPerChunk
+	if pos+8*chunks > len(b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	offsets := b[pos : pos+8*chunks]
+
+	for i := 0; i < chunks; i++ {
+		offset := binary.LittleEndian.Uint64(offsets[i*8:])
+		if offset > uint64(len(b)-8) {
+			return nil, fmt.Errorf("chunk %d is past the end of the file", i)
+		}
+
+		chunk := b[offset:]
+		y := int(int32(binary.LittleEndian.Uint32(chunk)))
+		size := int(int32(binary.LittleEndian.Uint32(chunk[4:])))
+		if size < 0 || size > len(chunk)-8 {
+			return nil, fmt.Errorf("chunk %d is past the end of the file", i)
+		}
+		data := chunk[8 : 8+size]
+
+		if y < dataWindow.Min.Y || y >= dataWindow.Max.Y || (y-dataWindow.Min.Y)%linesPerChunk != 0 {
+			return nil, fmt.Errorf("chunk %d starts at invalid line %d", i, y)
+		}
+		lines := linesPerChunk
+		if y+lines > dataWindow.Max.Y {
+			lines = dataWindow.Max.Y - y
+		}
+
+		// chunks that would get bigger when compressed are stored as-is
+		if want := lines * bytesPerLine; size < want {
+			var err error
+			switch compression {
+			case exrRLECompression:
+				data, err = exrUnRLE(data, want)
+			case exrZIPSCompression, exrZIPCompression:
+				data, err = exrUnZIP(data, want)
+			case exrPIZCompression:
+				data, err = exrUnPIZ(data, want, channels, width, lines)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("chunk %d: %w", i, err)
+			}
+		}
+		if len(data) != lines*bytesPerLine {
+			return nil, fmt.Errorf("chunk %d has %d bytes of pixel data, but should have %d", i, len(data), lines*bytesPerLine)
+		}
+
+		// each line has all of the values for one channel, then all of the values for the next
+		for line := 0; line < lines; line++ {
+			row := (y - dataWindow.Min.Y + line) * width
+			for _, c := range channels {
+				dst := img.Channels[c.name][row : row+width]
+				size := exrPixelSize(c.pixelType)
+				for x := range dst {
+					switch c.pixelType {
+					case exrUint:
+						dst[x] = float32(binary.LittleEndian.Uint32(data))
+					case exrHalf:
+						dst[x] = halfToFloat(binary.LittleEndian.Uint16(data))
+					case exrFloat:
+						dst[x] = math.Float32frombits(binary.LittleEndian.Uint32(data))
+					}
+					data = data[size:]
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+func parseEXRChannels(b []byte) ([]exrChannel, error) {
+	var channels []exrChannel
+	for {
+		end := bytes.IndexByte(b, 0)
+		if end == -1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if end == 0 {
+			break
+		}
+
+		c := exrChannel{name: string(b[:end])}
+		b = b[end+1:]
+		if len(b) < 16 {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		// pixel type, linear flag, three reserved bytes, and the sampling rates
+		c.pixelType = int32(binary.LittleEndian.Uint32(b))
+		c.xSampling = int32(binary.LittleEndian.Uint32(b[8:]))
+		c.ySampling = int32(binary.LittleEndian.Uint32(b[12:]))
+		b = b[16:]
+
+		channels = append(channels, c)
+	}
+
+	// they're supposed to be sorted already, but the pixel data is in this order either way
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].name < channels[j].name
+	})
+
+	return channels, nil
+}
+
+func exrPixelSize(pixelType int32) int {
+	if pixelType == exrHalf {
+		return 2
+	}
+
+	return 4
+}
+
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch exp {
+	case 0:
+		// zero or subnormal
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		// infinity or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// exrUnRLE expands runs, where a negative count is followed by that many
+// literal bytes, and any other count by one byte repeated count+1 times.
+func exrUnRLE(b []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for len(b) != 0 {
+		n := int(int8(b[0]))
+		b = b[1:]
+
+		if n < 0 {
+			if -n > len(b) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			out = append(out, b[:-n]...)
+			b = b[-n:]
+		} else {
+			if len(b) == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			for ; n >= 0; n-- {
+				out = append(out, b[0])
+			}
+			b = b[1:]
+		}
+
+		if len(out) > size {
+			return nil, errors.New("too much data")
+		}
+	}
+
+	return exrUnpredict(out), nil
+}
+
+func exrUnZIP(b []byte, size int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, size)
+	_, err = io.ReadFull(r, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return exrUnpredict(out), nil
+}
+
+// exrUnpredict undoes the delta encoding and byte interleaving that the RLE
+// and ZIP methods use to make the data more compressible.
+func exrUnpredict(t []byte) []byte {
+	for i := 1; i < len(t); i++ {
+		t[i] = t[i-1] + t[i] - 128
+	}
+
+	// the first half has the even bytes, and the second half the odd bytes
+	out := make([]byte, len(t))
+	half := (len(t) + 1) / 2
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = t[i/2]
+		} else {
+			out[i] = t[half+i/2]
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"math"
+	"os"
+	"testing"
+)
+
+// The files in testdata are 16x40 pixels with the data window starting at
+// (-2, 3), with half A, B, G, and R channels and a float Z channel. Each
+// channel is a staircase of 4x4 blocks, so that every chunk but the last PIZ
+// one is smaller compressed, and the values are exact as halfs.
+func TestDecodeEXR(t *testing.T) {
+	rect := image.Rect(-2, 3, 14, 43)
+	channels := []string{"A", "B", "G", "R", "Z"}
+	want := func(c, x, y int) float32 {
+		return float32((x+2)/4+(y-3)/4*4)/4 - float32(c)
+	}
+
+	for _, name := range []string{"none", "zip", "piz"} {
+		b, err := os.ReadFile("testdata/" + name + ".exr")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := decodeEXR(b)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if img.Rect != rect {
+			t.Errorf("%s: data window is %v, want %v", name, img.Rect, rect)
+			continue
+		}
+		if len(img.Channels) != len(channels) {
+			t.Errorf("%s: %d channels, want %d", name, len(img.Channels), len(channels))
+		}
+
+		for c, channel := range channels {
+			values := img.Channels[channel]
+			if len(values) != rect.Dx()*rect.Dy() {
+				t.Errorf("%s: channel %s has %d values, want %d", name, channel, len(values), rect.Dx()*rect.Dy())
+				continue
+			}
+
+			mismatches := 0
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					got := values[(y-rect.Min.Y)*rect.Dx()+x-rect.Min.X]
+					if got != want(c, x, y) && mismatches < 5 {
+						t.Errorf("%s: channel %s at (%d, %d) is %v, want %v", name, channel, x, y, got, want(c, x, y))
+						mismatches++
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestHalfToFloat(t *testing.T) {
+	for _, tt := range []struct {
+		half uint16
+		want float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.333251953125},
+		{0x7bff, 65504},
+		// smallest and largest subnormals, and the smallest normal
+		{0x0001, 1.0 / (1 << 24)},
+		{0x8001, -1.0 / (1 << 24)},
+		{0x03ff, 1023.0 / (1 << 24)},
+		{0x0400, 1.0 / (1 << 14)},
+		{0x7c00, float32(math.Inf(1))},
+		{0xfc00, float32(math.Inf(-1))},
+	} {
+		if got := halfToFloat(tt.half); got != tt.want {
+			t.Errorf("halfToFloat(%#04x) = %v, want %v", tt.half, got, tt.want)
+		}
+	}
+
+	if got := halfToFloat(0x8000); got != 0 || !math.Signbit(float64(got)) {
+		t.Errorf("halfToFloat(0x8000) = %v, want -0", got)
+	}
+	if got := halfToFloat(0x7e00); !math.IsNaN(float64(got)) {
+		t.Errorf("halfToFloat(0x7e00) = %v, want NaN", got)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// This is a port of the PIZ decompressor from the OpenEXR library: a lookup
+// table that maps the values actually used onto a smaller range, a 2D Haar
+// wavelet transform, and Huffman coding.
+
+const (
+	pizBitmapSize  = 8192
+	pizUshortRange = 1 << 16
+
+	hufEncSize = 1<<16 + 1
+	hufDecBits = 14
+	hufDecSize = 1 << hufDecBits
+	hufDecMask = hufDecSize - 1
+
+	hufShortZeroRun = 59
+	hufLongZeroRun  = 63
+	hufShortestLong = 2 + hufLongZeroRun - hufShortZeroRun
+)
+
+var errPIZ = errors.New("corrupt PIZ data")
+
+func exrUnPIZ(b []byte, size int, channels []exrChannel, width, lines int) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var bitmap [pizBitmapSize]byte
+	minNonZero := int(binary.LittleEndian.Uint16(b))
+	maxNonZero := int(binary.LittleEndian.Uint16(b[2:]))
+	b = b[4:]
+	if maxNonZero >= pizBitmapSize {
+		return nil, errPIZ
+	}
+	if minNonZero <= maxNonZero {
+		n := maxNonZero - minNonZero + 1
+		if n > len(b) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		copy(bitmap[minNonZero:], b[:n])
+		b = b[n:]
+	}
+
+	// the values were replaced with their indices in the list of values that are used
+	lut := make([]uint16, pizUshortRange)
+	k := 0
+	for i := 0; i < pizUshortRange; i++ {
+		if i == 0 || bitmap[i>>3]&(1<<(i&7)) != 0 {
+			lut[k] = uint16(i)
+			k++
+		}
+	}
+	maxValue := uint16(k - 1)
+
+	if len(b) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	length := int(int32(binary.LittleEndian.Uint32(b)))
+	b = b[4:]
+	if length < 0 || length > len(b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buf := make([]uint16, size/2)
+	err := hufUncompress(b[:length], buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// each channel is transformed separately, with multi-short values (floats) as interleaved planes
+	start := 0
+	starts := make([]int, len(channels))
+	for i, c := range channels {
+		starts[i] = start
+		n := exrPixelSize(c.pixelType) / 2
+		for j := 0; j < n; j++ {
+			wav2Decode(buf[start+j:], width, n, lines, width*n, maxValue)
+		}
+		start += width * lines * n
+	}
+
+	for i := range buf {
+		buf[i] = lut[buf[i]]
+	}
+
+	// the buffer has each channel's lines together; the output has each line's channels together
+	out := make([]byte, 0, size)
+	for y := 0; y < lines; y++ {
+		for i, c := range channels {
+			n := width * exrPixelSize(c.pixelType) / 2
+			for _, v := range buf[starts[i] : starts[i]+n] {
+				out = binary.LittleEndian.AppendUint16(out, v)
+			}
+			starts[i] += n
+		}
+	}
+
+	return out, nil
+}
+
+func wdec14(l, h uint16) (uint16, uint16) {
+	ls, hi := int(int16(l)), int(int16(h))
+	ai := ls + (hi & 1) + (hi >> 1)
+	return uint16(int16(ai)), uint16(int16(ai - hi))
+}
+
+func wdec16(l, h uint16) (uint16, uint16) {
+	const aOffset, modMask = 1 << 15, 1<<16 - 1
+	m, d := int(l), int(h)
+	bb := (m - (d >> 1)) & modMask
+	aa := (d + bb - aOffset) & modMask
+	return uint16(aa), uint16(bb)
+}
+
+// wav2Decode undoes the wavelet transform of an nx by ny block of values,
+// which are ox apart horizontally and oy apart vertically.
+func wav2Decode(in []uint16, nx, ox, ny, oy int, maxValue uint16) {
+	wdec := wdec16
+	if maxValue < 1<<14 {
+		wdec = wdec14
+	}
+
+	n := ny
+	if nx < n {
+		n = nx
+	}
+	p := 1
+	for p <= n {
+		p <<= 1
+	}
+	p >>= 1
+	p2 := p
+	p >>= 1
+
+	for p >= 1 {
+		py := 0
+		ey := oy * (ny - p2)
+		oy1, oy2 := oy*p, oy*p2
+		ox1, ox2 := ox*p, ox*p2
+
+		for ; py <= ey; py += oy2 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				p10 := px + oy1
+				p11 := p10 + ox1
+
+				i00, i10 := wdec(in[px], in[p10])
+				i01, i11 := wdec(in[p01], in[p11])
+				in[px], in[p01] = wdec(i00, i01)
+				in[p10], in[p11] = wdec(i10, i11)
+			}
+
+			// odd column
+			if nx&p != 0 {
+				p10 := px + oy1
+				in[px], in[p10] = wdec(in[px], in[p10])
+			}
+		}
+
+		// odd line
+		if ny&p != 0 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				in[px], in[p01] = wdec(in[px], in[p01])
+			}
+		}
+
+		p2 = p
+		p >>= 1
+	}
+}
+
+// a Huffman decoding table entry: either a code of at most hufDecBits bits,
+// or the list of longer codes that start with these bits
+type hufDec struct {
+	len  int
+	lit  int
+	long []int
+}
+
+func hufUncompress(b []byte, out []uint16) error {
+	if len(b) == 0 {
+		if len(out) != 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	if len(b) < 20 {
+		return io.ErrUnexpectedEOF
+	}
+
+	im := int(binary.LittleEndian.Uint32(b))
+	iM := int(binary.LittleEndian.Uint32(b[4:]))
+	nBits := int(binary.LittleEndian.Uint32(b[12:]))
+	if im < 0 || im >= hufEncSize || iM < 0 || iM >= hufEncSize {
+		return errPIZ
+	}
+	b = b[20:]
+
+	codes, b, err := hufUnpackEncTable(b, im, iM)
+	if err != nil {
+		return err
+	}
+	if nBits < 0 || (nBits+7)/8 > len(b) {
+		return io.ErrUnexpectedEOF
+	}
+
+	dec, err := hufBuildDecTable(codes, im, iM)
+	if err != nil {
+		return err
+	}
+
+	return hufDecode(codes, dec, b, nBits, iM, out)
+}
+
+func hufLength(code uint64) int {
+	return int(code & 63)
+}
+
+func hufCode(code uint64) uint64 {
+	return code >> 6
+}
+
+// hufUnpackEncTable reads the code lengths and turns them into codes; each
+// entry is the code shifted left by 6 plus its length.
+func hufUnpackEncTable(b []byte, im, iM int) ([]uint64, []byte, error) {
+	codes := make([]uint64, hufEncSize)
+
+	var c uint64
+	lc := 0
+	getBits := func(n int) (uint64, bool) {
+		for lc < n {
+			if len(b) == 0 {
+				return 0, false
+			}
+			c = c<<8 | uint64(b[0])
+			b = b[1:]
+			lc += 8
+		}
+		lc -= n
+		return (c >> lc) & (1<<n - 1), true
+	}
+
+	for ; im <= iM; im++ {
+		l, ok := getBits(6)
+		if !ok {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		codes[im] = l
+
+		zeroRun := 0
+		if l == hufLongZeroRun {
+			n, ok := getBits(8)
+			if !ok {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+			zeroRun = int(n) + hufShortestLong
+		} else if l >= hufShortZeroRun {
+			zeroRun = int(l) - hufShortZeroRun + 2
+		}
+
+		if zeroRun != 0 {
+			if im+zeroRun > iM+1 {
+				return nil, nil, errPIZ
+			}
+			for ; zeroRun > 0; zeroRun-- {
+				codes[im] = 0
+				im++
+			}
+			im--
+		}
+	}
+
+	// canonical codes: count the codes of each length, then number them from the longest down
+	var n [59]uint64
+	for _, l := range codes {
+		n[l]++
+	}
+	var c2 uint64
+	for i := 58; i > 0; i-- {
+		nc := (c2 + n[i]) >> 1
+		n[i] = c2
+		c2 = nc
+	}
+	for i, l := range codes {
+		if l > 0 {
+			codes[i] = l | n[l]<<6
+			n[l]++
+		}
+	}
+
+	return codes, b, nil
+}
+
+func hufBuildDecTable(codes []uint64, im, iM int) ([]hufDec, error) {
+	dec := make([]hufDec, hufDecSize)
+	for ; im <= iM; im++ {
+		c := hufCode(codes[im])
+		l := hufLength(codes[im])
+		if c>>l != 0 {
+			return nil, errPIZ
+		}
+
+		if l > hufDecBits {
+			pl := &dec[c>>(l-hufDecBits)]
+			if pl.len != 0 {
+				return nil, errPIZ
+			}
+			pl.long = append(pl.long, im)
+		} else if l != 0 {
+			base := int(c << (hufDecBits - l))
+			for i := 0; i < 1<<(hufDecBits-l); i++ {
+				pl := &dec[base+i]
+				if pl.len != 0 || pl.long != nil {
+					return nil, errPIZ
+				}
+				pl.len = l
+				pl.lit = im
+			}
+		}
+	}
+
+	return dec, nil
+}
+
+func hufDecode(codes []uint64, dec []hufDec, in []byte, nBits, rlc int, out []uint16) error {
+	var c uint64
+	lc := 0
+	o := 0
+	in = in[:(nBits+7)/8]
+
+	// rlc is followed by the number of times to repeat the previous value
+	put := func(sym int) error {
+		if sym == rlc {
+			if lc < 8 {
+				if len(in) == 0 {
+					return io.ErrUnexpectedEOF
+				}
+				c = c<<8 | uint64(in[0])
+				in = in[1:]
+				lc += 8
+			}
+			lc -= 8
+			n := int(uint8(c >> lc))
+			if o+n > len(out) {
+				return errPIZ
+			}
+			if o == 0 {
+				return errPIZ
+			}
+			for ; n > 0; n-- {
+				out[o] = out[o-1]
+				o++
+			}
+			return nil
+		}
+
+		if o >= len(out) {
+			return errPIZ
+		}
+		out[o] = uint16(sym)
+		o++
+		return nil
+	}
+
+	for len(in) != 0 {
+		c = c<<8 | uint64(in[0])
+		in = in[1:]
+		lc += 8
+
+		for lc >= hufDecBits {
+			pl := dec[(c>>(lc-hufDecBits))&hufDecMask]
+			if pl.len != 0 {
+				lc -= pl.len
+				if err := put(pl.lit); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if pl.long == nil {
+				return errPIZ
+			}
+
+			found := false
+			for _, sym := range pl.long {
+				l := hufLength(codes[sym])
+				for lc < l && len(in) != 0 {
+					c = c<<8 | uint64(in[0])
+					in = in[1:]
+					lc += 8
+				}
+
+				if lc >= l && hufCode(codes[sym]) == (c>>(lc-l))&(1<<l-1) {
+					lc -= l
+					if err := put(sym); err != nil {
+						return err
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errPIZ
+			}
+		}
+	}
+
+	// the last few codes are shorter than hufDecBits
+	i := (8 - nBits) & 7
+	c >>= i
+	lc -= i
+	for lc > 0 {
+		pl := dec[(c<<(hufDecBits-lc))&hufDecMask]
+		if pl.len == 0 {
+			return errPIZ
+		}
+		lc -= pl.len
+		if err := put(pl.lit); err != nil {
+			return err
+		}
+	}
+
+	if o != len(out) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
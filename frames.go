@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the render frame each frame name refers to, unless -frame-markers is set
+var renderFrames = map[string]int{
+	"base": 0,
+
+	"logo_hover":           1,
+	"settings_hover":       2, // also hovers notifications
+	"quit_hover":           3,
+	"profile_hover":        4,
+	"create_lobby_hover":   5,
+	"event_timer_3_hover":  6,
+	"event_timer_2_hover":  7,
+	"event_timer_1_hover":  8,
+	"quick_join_2_hover":   9,
+	"hoiaf_timer_hover":    10,
+	"hoiaf_top_1_hover":    11,
+	"hoiaf_top_10_1_hover": 12,
+	"hoiaf_top_10_2_hover": 13,
+	"hoiaf_top_10_9_hover": 15,
+	"update_hover":         16,
+	"news_hover":           17,
+	"quick_join_1_hover":   18,
+	"singleplayer_hover":   19,
+	"top_button_3_hover":   20,
+	"workshop_hover":       21, // also dulls notifications
+
+	"top_bar":               22,
+	"top_bar_settings_glow": 23, // also notifications
+	"top_bar_logo_glow":     24, // also quit
+	"top_bar_profile_glow":  25, // also hoiaf and the top buttons
+}
+
+// the frame names in use, set by loadLayout
+var frameNumbers map[string]int
+
+// frameNumber returns the render frame a frame name refers to. loadLayout
+// has already checked that every name in the layout tables exists.
+func frameNumber(name string) int {
+	i, ok := frameNumbers[name]
+	if !ok {
+		panic(fmt.Errorf("unknown frame %q", name))
+	}
+
+	return i
+}
+
+// frameNamesOf returns the names of a render frame, separated by commas.
+func frameNamesOf(i int) string {
+	var names []string
+	for name, j := range frameNumbers {
+		if i == j {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// parseFrame accepts either a frame name or a render frame number.
+func parseFrame(s string) (int, error) {
+	if i, ok := frameNumbers[s]; ok {
+		return i, nil
+	}
+
+	if i, err := strconv.Atoi(s); err == nil {
+		return i, nil
+	}
+
+	return 0, fmt.Errorf("unknown frame %q", s)
+}
+
+// loadFrameNames sets frameNumbers from the frames table or the timeline
+// markers, and returns an error listing any frame names used by the layout
+// tables that don't exist.
+func loadFrameNames() error {
+	if *frameMarkers != "" {
+		markers, err := readBlendMarkers(*frameMarkers)
+		if err != nil {
+			return err
+		}
+
+		frameNumbers = make(map[string]int, len(markers))
+		for name, frame := range markers {
+			// markers are on Blender's timeline, which is numbered the same way as the files
+			frameNumbers[name] = frame - *startFrame
+		}
+	} else {
+		frameNumbers = renderFrames
+	}
+
+	unknown := make(map[string][]string)
+	check := func(sheetIndex int, name, sequence string) {
+		if _, ok := frameNumbers[name]; !ok {
+			sheetName, _ := sheetNames(sheetIndex)
+			unknown[name] = append(unknown[name], sheetName+"/"+sequence)
+		}
+	}
+
+	for i, s := range sheets {
+		for _, a := range s.areas {
+			for _, f := range a.frames {
+				check(i, f.render, a.name+f.suffix)
+			}
+		}
+		for _, g := range s.groups {
+			for _, f := range g.frames {
+				check(i, f.render, g.name+f.suffix)
+			}
+		}
+	}
+
+	for i, s := range additiveSheets {
+		checkAdditive := func(name string, f additiveFrame) {
+			check(len(sheets)+i, f.base, name+f.suffix)
+			check(len(sheets)+i, f.render, name+f.suffix)
+		}
+
+		for _, a := range s.areas {
+			for _, f := range a.frames {
+				checkAdditive(a.name, f)
+			}
+		}
+		for _, g := range s.groups {
+			for _, m := range g.members() {
+				for _, f := range g.frames[m] {
+					checkAdditive(g.name, f)
+				}
+			}
+			for _, f := range g.indexed {
+				checkAdditive(g.name, f.frame)
+			}
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n  %q (used by %s)", name, strings.Join(unknown[name], ", "))
+	}
+
+	source := "the frames table"
+	if *frameMarkers != "" {
+		source = "the timeline markers in " + *frameMarkers
+	}
+
+	return fmt.Errorf("%d frame names are not in %s:%s", len(names), source, b.String())
+}
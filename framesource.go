@@ -0,0 +1,340 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a frameSource is a directory or archive of render frames (or glow passes),
+// which are looked up by their name relative to it. Archives are indexed when
+// they are opened, so any one file can be read without reading the others.
+type frameSource interface {
+	// stat returns an error matching fs.ErrNotExist if the source has no file with that name.
+	stat(name string) (fs.FileInfo, error)
+	open(name string) (io.ReadCloser, error)
+}
+
+// a file in a frame source
+type sourceFile struct {
+	src frameSource
+	// the directory or archive
+	dir  string
+	name string
+}
+
+// path is used in messages and cache keys.
+func (f sourceFile) path() string {
+	return filepath.Join(f.dir, f.name)
+}
+
+func (f sourceFile) stat() (fs.FileInfo, error) {
+	return f.src.stat(f.name)
+}
+
+func (f sourceFile) open() (io.ReadCloser, error) {
+	return f.src.open(f.name)
+}
+
+func (f sourceFile) readAll() ([]byte, error) {
+	r, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// isArchive returns true if a -input-dir or -sample-dirs entry is an archive rather than a directory.
+func isArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range [...]string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type openedSource struct {
+	src     frameSource
+	size    int64
+	modTime time.Time
+}
+
+// archives that have already been indexed, by name
+var openedSources = make(map[string]*openedSource)
+
+// openFrameSource returns the source for a -input-dir or -sample-dirs entry.
+// Archives are re-opened if they have changed since they were last opened.
+func openFrameSource(name string) (frameSource, error) {
+	if !isArchive(name) {
+		return dirSource(name), nil
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if o, ok := openedSources[name]; ok {
+		if o.size == fi.Size() && o.modTime.Equal(fi.ModTime()) {
+			return o.src, nil
+		}
+
+		if c, ok := o.src.(io.Closer); ok {
+			c.Close()
+		}
+		delete(openedSources, name)
+	}
+
+	var src frameSource
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		src, err = openZipSource(name)
+	} else {
+		src, err = openTarSource(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	openedSources[name] = &openedSource{
+		src:     src,
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+	}
+
+	return src, nil
+}
+
+type dirSource string
+
+func (d dirSource) stat(name string) (fs.FileInfo, error) {
+	return os.Stat(filepath.Join(string(d), name))
+}
+
+func (d dirSource) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), name))
+}
+
+type zipSource struct {
+	r     *zip.ReadCloser
+	files map[string]*zip.File
+}
+
+func openZipSource(name string) (*zipSource, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() {
+			files[f.Name] = f
+		}
+	}
+
+	return &zipSource{
+		r:     r,
+		files: stripArchiveDir(files),
+	}, nil
+}
+
+func (s *zipSource) stat(name string) (fs.FileInfo, error) {
+	f, ok := s.files[filepath.ToSlash(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f.FileInfo(), nil
+}
+
+func (s *zipSource) open(name string) (io.ReadCloser, error) {
+	f, ok := s.files[filepath.ToSlash(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f.Open()
+}
+
+func (s *zipSource) Close() error {
+	return s.r.Close()
+}
+
+type tarEntry struct {
+	header *tar.Header
+	// where the file's contents start in the (decompressed) archive
+	offset int64
+}
+
+type tarSource struct {
+	f       *os.File
+	gzipped bool
+	entries map[string]tarEntry
+
+	// a gzipped archive can only be read from the start, so this keeps the
+	// decompressor around between reads; the frames are read in order, so it
+	// rarely has to start over
+	mu  sync.Mutex
+	gz  *gzip.Reader
+	pos int64
+}
+
+func openTarSource(name string) (*tarSource, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &tarSource{
+		f:       f,
+		gzipped: !strings.HasSuffix(strings.ToLower(name), ".tar"),
+		entries: make(map[string]tarEntry),
+	}
+
+	// archive/tar doesn't read ahead, so the position after each header is where the contents start
+	var offset func() (int64, error)
+	var r io.Reader = f
+	if s.gzipped {
+		s.gz, err = gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		cr := &countingReader{r: s.gz}
+		r = cr
+		offset = func() (int64, error) { return cr.n, nil }
+	} else {
+		offset = func() (int64, error) { return f.Seek(0, io.SeekCurrent) }
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		pos, err := offset()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		s.entries[strings.TrimPrefix(hdr.Name, "./")] = tarEntry{hdr, pos}
+	}
+	s.entries = stripArchiveDir(s.entries)
+
+	// the next read starts over
+	s.pos = -1
+
+	return s, nil
+}
+
+func (s *tarSource) stat(name string) (fs.FileInfo, error) {
+	e, ok := s.entries[filepath.ToSlash(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return e.header.FileInfo(), nil
+}
+
+func (s *tarSource) open(name string) (io.ReadCloser, error) {
+	e, ok := s.entries[filepath.ToSlash(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !s.gzipped {
+		return io.NopCloser(io.NewSectionReader(s.f, e.offset, e.header.Size)), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pos < 0 || e.offset < s.pos {
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := s.gz.Reset(s.f); err != nil {
+			return nil, err
+		}
+		s.pos = 0
+	}
+
+	if _, err := io.CopyN(io.Discard, s.gz, e.offset-s.pos); err != nil {
+		s.pos = -1
+		return nil, err
+	}
+
+	b := make([]byte, e.header.Size)
+	if _, err := io.ReadFull(s.gz, b); err != nil {
+		s.pos = -1
+		return nil, err
+	}
+	s.pos = e.offset + e.header.Size
+
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *tarSource) Close() error {
+	return s.f.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// stripArchiveDir removes the directory from the names if every file in the
+// archive is in the same one, so zipping the render output directory works
+// the same as zipping the files in it.
+func stripArchiveDir[T any](files map[string]T) map[string]T {
+	dir := ""
+	for name := range files {
+		i := strings.IndexByte(name, '/')
+		if i == -1 || (dir != "" && name[:i+1] != dir) {
+			return files
+		}
+		dir = name[:i+1]
+	}
+	if dir == "" {
+		return files
+	}
+
+	stripped := make(map[string]T, len(files))
+	for name, f := range files {
+		stripped[strings.TrimPrefix(name, dir)] = f
+	}
+
+	return stripped
+}
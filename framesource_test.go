@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testFrames = []struct {
+	name string
+	data string
+}{
+	{"mainmenu_0000.png", "frame zero"},
+	{"mainmenu_0001.png", "frame one, which is a bit longer"},
+	{"mainmenu_0002.png", ""},
+	{"glow/mainmenu_0001.png", "glow pass for frame one"},
+}
+
+func writeTestZip(t *testing.T, name, prefix string) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := zip.NewWriter(f)
+	if prefix != "" {
+		if _, err := w.Create(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tf := range testFrames {
+		fw, err := w.Create(prefix + tf.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, tf.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTar(t *testing.T, name, prefix string, gzipped bool) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out io.Writer = f
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(f)
+		out = gz
+	}
+
+	w := tar.NewWriter(out)
+	if prefix != "" {
+		if err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: prefix, Mode: 0755}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tf := range testFrames {
+		if err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: prefix + tf.name, Mode: 0644, Size: int64(len(tf.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, tf.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrameSources(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		name   string
+		prefix string
+		write  func(name, prefix string)
+	}{
+		{"frames.zip", "", func(name, prefix string) { writeTestZip(t, name, prefix) }},
+		{"renders.zip", "renders/", func(name, prefix string) { writeTestZip(t, name, prefix) }},
+		{"frames.tar", "./", func(name, prefix string) { writeTestTar(t, name, prefix, false) }},
+		{"renders.tar", "renders/", func(name, prefix string) { writeTestTar(t, name, prefix, false) }},
+		{"frames.tar.gz", "", func(name, prefix string) { writeTestTar(t, name, prefix, true) }},
+		{"renders.tgz", "renders/", func(name, prefix string) { writeTestTar(t, name, prefix, true) }},
+	} {
+		name := filepath.Join(dir, tt.name)
+		tt.write(name, tt.prefix)
+
+		if !isArchive(name) {
+			t.Errorf("%s: not recognized as an archive", tt.name)
+			continue
+		}
+
+		src, err := openFrameSource(name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		// backwards and repeated, so the gzipped tar has to start over
+		for _, i := range []int{1, 0, 3, 1, 2, 0} {
+			tf := testFrames[i]
+			file := sourceFile{src, name, filepath.FromSlash(tf.name)}
+
+			fi, err := file.stat()
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			if fi.Size() != int64(len(tf.data)) {
+				t.Errorf("%s: %s is %d bytes, want %d", tt.name, tf.name, fi.Size(), len(tf.data))
+			}
+
+			b, err := file.readAll()
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if string(b) != tf.data {
+				t.Errorf("%s: %s is %q, want %q", tt.name, tf.name, b, tf.data)
+			}
+		}
+
+		if _, err := src.stat("mainmenu_0003.png"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: stat of a missing file returned %v", tt.name, err)
+		}
+		if _, err := src.open("mainmenu_0003.png"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: open of a missing file returned %v", tt.name, err)
+		}
+	}
+}
+
+func TestFrameSourceReopen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "frames.zip")
+	writeTestZip(t, name, "")
+
+	src, err := openFrameSource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := openFrameSource(name); err != nil || again != src {
+		t.Errorf("opening an unchanged archive again returned %v, %v; want the same source", again, err)
+	}
+
+	// the same names in a different directory
+	writeTestZip(t, name, "renders/more/")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := openFrameSource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == src {
+		t.Fatal("opening a changed archive returned the old source")
+	}
+	if _, err := changed.stat("more/mainmenu_0000.png"); err != nil {
+		t.Errorf("changed archive: %v", err)
+	}
+}
+
+func TestStripArchiveDir(t *testing.T) {
+	for _, tt := range []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"a.png", "b.png"}, []string{"a.png", "b.png"}},
+		{[]string{"renders/a.png", "renders/b.png"}, []string{"a.png", "b.png"}},
+		{[]string{"renders/a.png", "renders/glow/a.png"}, []string{"a.png", "glow/a.png"}},
+		{[]string{"renders/a.png", "b.png"}, []string{"renders/a.png", "b.png"}},
+		{[]string{"renders/a.png", "other/b.png"}, []string{"renders/a.png", "other/b.png"}},
+		{nil, nil},
+	} {
+		files := make(map[string]bool)
+		for _, name := range tt.names {
+			files[name] = true
+		}
+		want := make(map[string]bool)
+		for _, name := range tt.want {
+			want[name] = true
+		}
+
+		if got := stripArchiveDir(files); !reflect.DeepEqual(got, want) {
+			t.Errorf("stripArchiveDir(%v) = %v, want %v", tt.names, got, want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+type glowKind int
+
+const (
+	glowNone glowKind = iota
+	// light spilling out around the element
+	glowOuter
+	// light along the inside of the element's edge
+	glowInner
+	// the element tinted by distance from its edge
+	glowRamp
+)
+
+func (k glowKind) String() string {
+	switch k {
+	case glowNone:
+		return "none"
+	case glowOuter:
+		return "outer glow"
+	case glowInner:
+		return "inner glow"
+	case glowRamp:
+		return "color ramp"
+	}
+
+	return fmt.Sprintf("glowKind(%d)", int(k))
+}
+
+type glowStyle struct {
+	kind glowKind
+	// distance from the edge, in pixels, at which the glow fades out or the ramp ends
+	size float64
+	// brightness at the edge, from 0 to 1
+	strength float64
+	// glows use the first color; ramps go from the first color at the edge to the last color inside
+	colors []color.NRGBA
+}
+
+// a hover overlay generated from the alpha of an area's base frame, rather
+// than from a hover frame
+type generatedFrame struct {
+	base   string
+	suffix string
+	style  glowStyle
+}
+
+// styles of the generated sequences, by sheet name and sequence name, set by loadLayout
+var generatedStyles map[string]glowStyle
+
+// addGeneratedHovers adds the generatedHovers table to the additive areas as
+// frames that use the base frame for both the base and the hover. It must run
+// after the groups are expanded, since the table uses instance IDs.
+func addGeneratedHovers() error {
+	generatedStyles = make(map[string]glowStyle)
+
+	var problems []string
+	found := make(map[string]bool)
+	for i := range additiveSheets {
+		s := &additiveSheets[i]
+		for j, id := range areaInstanceIDs(s.areas) {
+			frames, ok := generatedHovers[id]
+			if !ok {
+				continue
+			}
+			found[id] = true
+
+			a := &s.areas[j]
+			// don't modify the declared table's frames
+			a.frames = append([]additiveFrame(nil), a.frames...)
+			for _, f := range frames {
+				if _, ok := frameNumbers[f.base]; !ok {
+					problems = append(problems, fmt.Sprintf("generated hover %s%s uses unknown frame %q", id, f.suffix, f.base))
+					continue
+				}
+				if err := f.style.check(); err != nil {
+					problems = append(problems, fmt.Sprintf("generated hover %s%s: %v", id, f.suffix, err))
+					continue
+				}
+
+				a.frames = append(a.frames, additiveFrame{f.base, f.base, f.suffix})
+				generatedStyles[s.name+"/"+a.name+f.suffix] = f.style
+			}
+		}
+	}
+
+	for id := range generatedHovers {
+		if !found[id] {
+			problems = append(problems, fmt.Sprintf("there are generated hovers for area %s, but no additive area has that instance ID", id))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+
+	return fmt.Errorf("%d problems with the generated hovers:\n  %s", len(problems), strings.Join(problems, "\n  "))
+}
+
+// isGenerated returns true for the sequences added by addGeneratedHovers,
+// which have no hover frame of their own.
+func isGenerated(sheetName, sequence string) bool {
+	_, ok := generatedStyles[sheetName+"/"+sequence]
+
+	return ok
+}
+
+func (style glowStyle) check() error {
+	switch {
+	case style.kind == glowNone:
+		return fmt.Errorf("no kind of glow")
+	case style.kind == glowRamp && len(style.colors) < 2:
+		return fmt.Errorf("a color ramp needs at least 2 colors, but has %d", len(style.colors))
+	case len(style.colors) == 0:
+		return fmt.Errorf("no color")
+	case style.size <= 0:
+		return fmt.Errorf("size is %v, but must be positive", style.size)
+	case style.strength <= 0:
+		return fmt.Errorf("strength is %v, but must be positive", style.strength)
+	}
+
+	return nil
+}
+
+// generatedStyle returns the style of a sequence that is generated rather
+// than cropped from a hover frame.
+func generatedStyle(sheetIndex int, name string) (glowStyle, bool) {
+	if sheetIndex < len(sheets) {
+		return glowStyle{}, false
+	}
+
+	sheetName, _ := sheetNames(sheetIndex)
+	style, ok := generatedStyles[sheetName+"/"+name]
+
+	return style, ok
+}
+
+// generateHover turns an additive sequence's base crop (crop2) into a glow
+// drawn around or inside the parts of it that are at least half opaque.
+func generateHover(s *sequence, mask []float32) {
+	style := s.generated
+	rect := s.crop2.Rect
+	w, h := rect.Dx(), rect.Dy()
+
+	solid := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// the same pixels as when the crop was rounded to 8 bits
+			solid[y*w+x] = s.crop2.Pix[s.crop2.offset(rect.Min.X+x, rect.Min.Y+y)+3] >= 127.5
+		}
+	}
+
+	// distances from transparent pixels to the element, and from the element
+	// to transparent pixels or the edge of the crop
+	outside := distanceTransform(solid, w, h, true)
+	inside := distanceTransform(solid, w, h, false)
+
+	diff := newFloatImage(rect.Sub(rect.Min))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			ca := s.crop2.Pix[s.crop2.offset(rect.Min.X+x, rect.Min.Y+y)+3]
+			a := float64(ca) / 255
+
+			var amount float64
+			col := style.colors[0]
+			switch style.kind {
+			case glowOuter:
+				if !solid[y*w+x] {
+					// so it fades in over anti-aliased edges
+					amount = glowFalloff(outside[y*w+x]-0.5, style.size) * (1 - a)
+				}
+			case glowInner:
+				amount = glowFalloff(inside[y*w+x]-0.5, style.size) * a
+			case glowRamp:
+				amount = a
+				col = rampColor(style.colors, math.Min(1, math.Max(0, (inside[y*w+x]-0.5)/style.size)))
+			}
+			amount *= style.strength * float64(col.A) / 255
+
+			o := diff.offset(x, y)
+			diff.Pix[o+0] = float32(float64(col.R) * amount)
+			diff.Pix[o+1] = float32(float64(col.G) * amount)
+			diff.Pix[o+2] = float32(float64(col.B) * amount)
+			diff.Pix[o+3] = ca
+		}
+	}
+
+	applyMask(diff, mask)
+
+	if dither == ditherNone {
+		for k := range diff.Pix {
+			diff.Pix[k] = float32(math.Floor(float64(diff.Pix[k])))
+		}
+	}
+
+	s.img = quantize(diff, dither)
+}
+
+// glowFalloff fades from 1 at the edge to 0 at size pixels away.
+func glowFalloff(d, size float64) float64 {
+	if d < 0 {
+		d = 0
+	}
+	if d >= size {
+		return 0
+	}
+
+	t := 1 - d/size
+	return t * t
+}
+
+// rampColor interpolates between evenly spaced colors.
+func rampColor(colors []color.NRGBA, t float64) color.NRGBA {
+	pos := t * float64(len(colors)-1)
+	i := int(pos)
+	if i >= len(colors)-1 {
+		return colors[len(colors)-1]
+	}
+
+	f := pos - float64(i)
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-f) + float64(b)*f))
+	}
+	c0, c1 := colors[i], colors[i+1]
+
+	return color.NRGBA{lerp(c0.R, c1.R), lerp(c0.G, c1.G), lerp(c0.B, c1.B), lerp(c0.A, c1.A)}
+}
+
+// distanceTransform returns the Euclidean distance from each pixel to the
+// nearest pixel where solid equals toSolid, so those pixels are at distance 0.
+// The pixels just past the edge of the image count as not solid.
+func distanceTransform(solid []bool, w, h int, toSolid bool) []float64 {
+	// padded by one pixel on each side
+	pw, ph := w+2, h+2
+	inf := float64(pw*pw + ph*ph)
+
+	d := make([]float64, pw*ph)
+	for y := 0; y < ph; y++ {
+		for x := 0; x < pw; x++ {
+			target := !toSolid
+			if x > 0 && y > 0 && x <= w && y <= h {
+				target = solid[(y-1)*w+x-1] == toSolid
+			}
+
+			if target {
+				d[y*pw+x] = 0
+			} else {
+				d[y*pw+x] = inf
+			}
+		}
+	}
+
+	// squared distances, one dimension at a time
+	f := make([]float64, max(pw, ph))
+	for x := 0; x < pw; x++ {
+		for y := 0; y < ph; y++ {
+			f[y] = d[y*pw+x]
+		}
+		out := distanceTransform1D(f[:ph])
+		for y := 0; y < ph; y++ {
+			d[y*pw+x] = out[y]
+		}
+	}
+	for y := 0; y < ph; y++ {
+		copy(d[y*pw:(y+1)*pw], distanceTransform1D(d[y*pw:(y+1)*pw]))
+	}
+
+	out := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out[y*w+x] = math.Sqrt(d[(y+1)*pw+x+1])
+		}
+	}
+
+	return out
+}
+
+// distanceTransform1D is Felzenszwalb and Huttenlocher's lower envelope of
+// parabolas, for squared distances.
+func distanceTransform1D(f []float64) []float64 {
+	n := len(f)
+	out := make([]float64, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+
+	k := 0
+	z[0], z[1] = math.Inf(-1), math.Inf(1)
+	for q := 1; q < n; q++ {
+		s := ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		for s <= z[k] {
+			k--
+			s = ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		}
+		k++
+		v[k] = q
+		z[k], z[k+1] = s, math.Inf(1)
+	}
+
+	k = 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		out[q] = float64((q-v[k])*(q-v[k])) + f[v[k]]
+	}
+
+	return out
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDistanceTransform(t *testing.T) {
+	const w, h = 5, 5
+	mask := func(solid func(x, y int) bool) []bool {
+		m := make([]bool, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				m[y*w+x] = solid(x, y)
+			}
+		}
+		return m
+	}
+
+	for _, tt := range []struct {
+		name    string
+		solid   []bool
+		toSolid bool
+		want    func(x, y int) float64
+	}{
+		{
+			"single pixel, outside",
+			mask(func(x, y int) bool { return x == 2 && y == 2 }),
+			true,
+			func(x, y int) float64 { return math.Hypot(float64(x-2), float64(y-2)) },
+		},
+		{
+			"single pixel, inside",
+			mask(func(x, y int) bool { return x == 2 && y == 2 }),
+			false,
+			func(x, y int) float64 {
+				if x == 2 && y == 2 {
+					return 1
+				}
+				return 0
+			},
+		},
+		{
+			// the pixels past the edge of the image are the nearest transparent ones
+			"solid, inside",
+			mask(func(x, y int) bool { return true }),
+			false,
+			func(x, y int) float64 { return float64(min(x+1, y+1, w-x, h-y)) },
+		},
+		{
+			"border, outside",
+			mask(func(x, y int) bool { return x == 0 || y == 0 || x == w-1 || y == h-1 }),
+			true,
+			func(x, y int) float64 { return float64(min(x, y, w-1-x, h-1-y)) },
+		},
+		{
+			"empty, inside",
+			mask(func(x, y int) bool { return false }),
+			false,
+			func(x, y int) float64 { return 0 },
+		},
+	} {
+		got := distanceTransform(tt.solid, w, h, tt.toSolid)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if d, want := got[y*w+x], tt.want(x, y); math.Abs(d-want) > 1e-9 {
+					t.Errorf("%s: distance at (%d, %d) is %v, want %v", tt.name, x, y, d, want)
+				}
+			}
+		}
+	}
+
+	// with nothing to measure to, every pixel must be far enough away that no glow reaches it
+	far := math.Hypot(w, h)
+	for i, d := range distanceTransform(make([]bool, w*h), w, h, true) {
+		if d < far {
+			t.Errorf("empty, outside: distance at (%d, %d) is %v, want at least %v", i%w, i/w, d, far)
+		}
+	}
+}
+
+func TestRampColor(t *testing.T) {
+	blackToWhite := []color.NRGBA{{0, 0, 0, 0}, {255, 255, 255, 255}}
+	rgb := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+
+	for _, tt := range []struct {
+		colors []color.NRGBA
+		t      float64
+		want   color.NRGBA
+	}{
+		{blackToWhite, 0, color.NRGBA{0, 0, 0, 0}},
+		{blackToWhite, 0.5, color.NRGBA{128, 128, 128, 128}},
+		{blackToWhite, 0.2, color.NRGBA{51, 51, 51, 51}},
+		{blackToWhite, 1, color.NRGBA{255, 255, 255, 255}},
+		{rgb, 0, color.NRGBA{255, 0, 0, 255}},
+		{rgb, 0.25, color.NRGBA{128, 128, 0, 255}},
+		{rgb, 0.5, color.NRGBA{0, 255, 0, 255}},
+		{rgb, 0.75, color.NRGBA{0, 128, 128, 255}},
+		{rgb, 1, color.NRGBA{0, 0, 255, 255}},
+	} {
+		if got := rampColor(tt.colors, tt.t); got != tt.want {
+			t.Errorf("rampColor(%v, %v) = %v, want %v", tt.colors, tt.t, got, tt.want)
+		}
+	}
+}
+
+// TestGeneratedHoverPacked adds a generated hover to the layout and runs a
+// sequence made from it through the packer.
+func TestGeneratedHoverPacked(t *testing.T) {
+	saved := generatedHovers
+	defer func() {
+		generatedHovers = saved
+		if err := loadLayout(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	generatedHovers = map[string][]generatedFrame{
+		"settings": {
+			{"base", "_outer_glow", glowStyle{glowOuter, 8, 1, []color.NRGBA{{255, 128, 0, 255}}}},
+		},
+	}
+	if err := loadLayout(); err != nil {
+		t.Fatal(err)
+	}
+
+	const name = "settings_outer_glow"
+	sheetIndex := len(sheets)
+	sheetName, _ := sheetNames(sheetIndex)
+	if !isGenerated(sheetName, name) {
+		t.Fatalf("%s/%s is not generated", sheetName, name)
+	}
+	listed := false
+	for _, n := range sheetSequenceNames(sheetIndex) {
+		listed = listed || n == name
+	}
+	if !listed {
+		t.Fatalf("%s has no %s sequence", sheetName, name)
+	}
+	style, ok := generatedStyle(sheetIndex, name)
+	if !ok || style.kind != glowOuter {
+		t.Fatalf("%s has style %+v", name, style)
+	}
+
+	// an opaque square in the middle of the crop
+	base := newFloatImage(image.Rect(0, 0, 32, 32))
+	for y := 12; y < 20; y++ {
+		for x := 12; x < 20; x++ {
+			o := base.offset(x, y)
+			copy(base.Pix[o:o+4], []float32{40, 40, 40, 255})
+		}
+	}
+
+	s := sequence{name: name, crop2: base, generated: style}
+	generateHover(&s, nil)
+
+	if c := s.img.NRGBAAt(15, 15); c.R != 0 || c.G != 0 || c.B != 0 {
+		t.Errorf("inside the element is %v, want no glow", c)
+	}
+	if c := s.img.NRGBAAt(11, 15); c.R == 0 || c.R <= c.G || c.B != 0 {
+		t.Errorf("next to the element is %v, want the glow color", c)
+	}
+	if c := s.img.NRGBAAt(0, 0); c.R != 0 || c.G != 0 || c.B != 0 {
+		t.Errorf("far from the element is %v, want no glow", c)
+	}
+
+	other := sequence{name: "other", img: image.NewNRGBA(image.Rect(0, 0, 16, 8))}
+	sequences := []sequence{s, other}
+	tex, sheetData, rects, _, _ := packSheet(sequences, []int{1, 0}, 64, true, true)
+	if tex == nil {
+		t.Fatal("failed to pack sheet")
+	}
+
+	parsed, err := parseSheetData(sheetData, tex.Rect.Dx(), tex.Rect.Dy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sequences {
+		if parsed[i] != rects[i] {
+			t.Errorf("sequence %d is at %v in the sheet data, but was packed at %v", i, parsed[i], rects[i])
+		}
+	}
+
+	packed := tex.SubImage(rects[0]).(*image.NRGBA)
+	for y := 0; y < s.img.Rect.Dy(); y++ {
+		for x := 0; x < s.img.Rect.Dx(); x++ {
+			if got, want := packed.NRGBAAt(rects[0].Min.X+x, rects[0].Min.Y+y), s.img.NRGBAAt(x, y); got != want {
+				t.Fatalf("packed pixel (%d, %d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -1,5 +1,7 @@
 module github.com/BenLubar/reactive-drop-main-menu
 
-go 1.20
+go 1.22
 
 require github.com/ftrvxmtrx/tga v0.0.0-20150524081124-bd8e8d5be13a
+
+require github.com/klauspost/compress v1.18.0
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// An area group is a set of identical elements, such as the rows of a
+// leaderboard. Members are numbered starting at 1, in the order their
+// rectangles are listed.
+//
+// Groups are expanded into one area per member by loadLayout, so
+// everything other than the layout tables and the generated headers sees
+// them as areas that share a name.
+type areaGroup struct {
+	name  string
+	rects []image.Rectangle
+	// the member the frames are cropped from
+	source int
+	frames []frame
+}
+
+type additiveAreaGroup struct {
+	name  string
+	rects []image.Rectangle
+	// frames cropped from a single member, by member number
+	frames map[int][]additiveFrame
+	// frames cropped from several members; the member number is appended to the sequence name
+	indexed []indexedFrame
+}
+
+type indexedFrame struct {
+	members []int
+	frame   additiveFrame
+}
+
+// memberRange returns the member numbers first through last.
+func memberRange(first, last int) []int {
+	members := make([]int, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		members = append(members, i)
+	}
+
+	return members
+}
+
+// indexedSuffix returns the suffix of the sequence cropped from the given member.
+func (f indexedFrame) indexedSuffix(member int) string {
+	return f.frame.suffix + "_" + strconv.Itoa(member)
+}
+
+// expandGroups appends the members of each group to its sheet's areas.
+func expandGroups() {
+	for i := range sheets {
+		for _, g := range sheets[i].groups {
+			sheets[i].areas = append(sheets[i].areas, g.expand()...)
+		}
+	}
+
+	for i := range additiveSheets {
+		for _, g := range additiveSheets[i].groups {
+			additiveSheets[i].areas = append(additiveSheets[i].areas, g.expand()...)
+		}
+	}
+}
+
+// expand returns one area per member. Frames for members that do not exist
+// are dropped here and reported by validateLayout.
+func (g *areaGroup) expand() []area {
+	areas := make([]area, len(g.rects))
+	for i, r := range g.rects {
+		areas[i] = area{g.name, r, []frame{}}
+	}
+
+	if g.source >= 1 && g.source <= len(areas) {
+		areas[g.source-1].frames = g.frames
+	}
+
+	return areas
+}
+
+func (g *additiveAreaGroup) expand() []additiveArea {
+	areas := make([]additiveArea, len(g.rects))
+	for i, r := range g.rects {
+		areas[i] = additiveArea{g.name, r, []additiveFrame{}}
+	}
+
+	for _, f := range g.indexed {
+		for _, m := range f.members {
+			if m >= 1 && m <= len(areas) {
+				af := f.frame
+				af.suffix = f.indexedSuffix(m)
+				areas[m-1].frames = append(areas[m-1].frames, af)
+			}
+		}
+	}
+
+	for _, m := range g.members() {
+		if m >= 1 && m <= len(areas) {
+			areas[m-1].frames = append(areas[m-1].frames, g.frames[m]...)
+		}
+	}
+
+	return areas
+}
+
+// members returns the member numbers that have frames, in order.
+func (g *additiveAreaGroup) members() []int {
+	members := make([]int, 0, len(g.frames))
+	for m := range g.frames {
+		members = append(members, m)
+	}
+	sort.Ints(members)
+
+	return members
+}
+
+// templateDifferences compares every member of a group to the member its
+// sequences are cropped from. The members of a base sheet group share a
+// single sequence, so anything that differs between them in the render will
+// be lost.
+func (g *areaGroup) templateDifferences(src *floatImage, frameIndex int) []string {
+	if g.source < 1 || g.source > len(g.rects) {
+		return nil
+	}
+
+	var problems []string
+	template := g.rects[g.source-1]
+	for i, r := range g.rects {
+		if i == g.source-1 || r.Size() != template.Size() {
+			continue
+		}
+
+		count, maxDiff := 0, 0
+		var bounds image.Rectangle
+		for y := 0; y < r.Dy(); y++ {
+			for x := 0; x < r.Dx(); x++ {
+				a := src.Pix[src.offset(template.Min.X+x, template.Min.Y+y):]
+				b := src.Pix[src.offset(r.Min.X+x, r.Min.Y+y):]
+
+				diff := absDiff(a[3], b[3])
+				if a[3] >= 0.5 || b[3] >= 0.5 {
+					// the color of a fully transparent pixel doesn't matter
+					for c := 0; c < 3; c++ {
+						if d := absDiff(a[c], b[c]); d > diff {
+							diff = d
+						}
+					}
+				}
+
+				if diff <= *templateTolerance {
+					continue
+				}
+
+				count++
+				if diff > maxDiff {
+					maxDiff = diff
+				}
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+
+		if count != 0 {
+			problems = append(problems, fmt.Sprintf("%s member %d differs from member %d in frame %d: %d pixels differ by up to %d, within %v of the member", g.name, i+1, g.source, frameIndex, count, maxDiff, bounds))
+		}
+	}
+
+	return problems
+}
+
+// absDiff returns the difference between two values, rounded to 8-bit steps.
+func absDiff(a, b float32) int {
+	return int(math.Round(math.Abs(float64(a - b))))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type sequenceSource struct {
+	rect image.Rectangle
+	// render frames the sequence is cropped from; for additive sequences, the base frame comes first
+	frames   []int
+	additive bool
+	// the style of a generated additive sequence
+	generated glowStyle
+	// for sequences shared by the members of an area group, where each member
+	// is drawn; rect is the template member the sequence is cropped from
+	instances []image.Rectangle
+}
+
+// sheetSequenceSources returns the area and render frames each sequence in a sheet is cropped from.
+func sheetSequenceSources(sheetIndex int) map[string]sequenceSource {
+	sources := make(map[string]sequenceSource)
+
+	if sheetIndex < len(sheets) {
+		for _, a := range sheets[sheetIndex].areas {
+			for _, f := range a.frames {
+				sources[a.name+f.suffix] = sequenceSource{
+					rect:   a.rect,
+					frames: []int{frameNumber(f.render)},
+				}
+			}
+		}
+
+		for _, g := range sheets[sheetIndex].groups {
+			for _, f := range g.frames {
+				src := sources[g.name+f.suffix]
+				src.instances = g.rects
+				sources[g.name+f.suffix] = src
+			}
+		}
+	} else {
+		for _, a := range additiveSheets[sheetIndex-len(sheets)].areas {
+			for _, f := range a.frames {
+				style, _ := generatedStyle(sheetIndex, a.name+f.suffix)
+				sources[a.name+f.suffix] = sequenceSource{
+					rect:      a.rect,
+					frames:    []int{frameNumber(f.base), frameNumber(f.render)},
+					additive:  true,
+					generated: style,
+				}
+			}
+		}
+	}
+
+	return sources
+}
+
+// writeSheetHeader writes a C++ header describing the sequences in a sheet.
+//
+// names must be in the same order as the sequences in the .sht file.
+func writeSheetHeader(sheetIndex int, names []string) {
+	name, enumName := sheetNames(sheetIndex)
+	sources := sheetSequenceSources(sheetIndex)
+
+	out, err := os.Create(outputPath(name + ".h"))
+	if err != nil {
+		panic(err)
+	}
+
+	guard := includeGuard(name + "_h")
+	fmt.Fprintf(out, "// generated by sliceanddice; do not edit\n\n")
+	fmt.Fprintf(out, "#ifndef %s\n#define %s\n#pragma once\n\n", guard, guard)
+
+	// the declarations the HUD sheet code expects, for use inside a class
+	fmt.Fprintf(out, "// usage (inside a class): %s;\n", includeGuard(name+"_declare_hud_sheet"))
+	fmt.Fprintf(out, "#define %s \\\n", includeGuard(name+"_declare_hud_sheet"))
+	fmt.Fprintf(out, "\tDECLARE_HUD_SHEET( %s ) \\\n", enumName)
+	for _, n := range names {
+		fmt.Fprintf(out, "\t\tDECLARE_HUD_SHEET_UV( %s ), \\\n", n)
+	}
+	fmt.Fprintf(out, "\tEND_HUD_SHEET( %s )\n\n", enumName)
+
+	fmt.Fprintf(out, "namespace %s\n{\n", enumName)
+	fmt.Fprintf(out, "\t// size of the rendered frames; the area positions below are in this coordinate space\n")
+	fmt.Fprintf(out, "\tconst int DESIGN_WIDTH = %d;\n", frameBounds.Dx())
+	fmt.Fprintf(out, "\tconst int DESIGN_HEIGHT = %d;\n\n", frameBounds.Dy())
+
+	fmt.Fprintf(out, "\tenum Sequence_t\n\t{\n")
+	for i, n := range names {
+		fmt.Fprintf(out, "\t\tUV_%s = %d,\n", n, i)
+	}
+	fmt.Fprintf(out, "\n\t\tNUM_SEQUENCES = %d\n\t};\n\n", len(names))
+
+	fmt.Fprintf(out, "\tstruct SequenceInfo_t\n\t{\n")
+	fmt.Fprintf(out, "\t\tconst char *szName;\n")
+	fmt.Fprintf(out, "\t\t// size of the sequence in source pixels\n")
+	fmt.Fprintf(out, "\t\tint nWidth, nHeight;\n")
+	fmt.Fprintf(out, "\t\tfloat flAspectRatio;\n")
+	fmt.Fprintf(out, "\t\t// position of the area the sequence was cropped from, in design space\n")
+	fmt.Fprintf(out, "\t\tint x, y;\n")
+	fmt.Fprintf(out, "\t};\n\n")
+
+	fmt.Fprintf(out, "\tconst SequenceInfo_t Sequences[NUM_SEQUENCES] =\n\t{\n")
+	for _, n := range names {
+		r := sources[n].rect
+		fmt.Fprintf(out, "\t\t{ %q, %d, %d, %sf, %d, %d },\n", n, r.Dx(), r.Dy(), formatFloat(float64(r.Dx())/float64(r.Dy())), r.Min.X, r.Min.Y)
+	}
+	fmt.Fprintf(out, "\t};\n")
+	writeGroupHelpers(out, sheetIndex)
+	fmt.Fprintf(out, "}\n\n#endif // %s\n", guard)
+
+	err = out.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// writeGroupHelpers writes the positions of each area group member, and
+// arrays for looking up indexed sequences by member.
+func writeGroupHelpers(out io.Writer, sheetIndex int) {
+	type groupInfo struct {
+		name    string
+		rects   []image.Rectangle
+		indexed []indexedFrame
+	}
+
+	var groups []groupInfo
+	if sheetIndex < len(sheets) {
+		for _, g := range sheets[sheetIndex].groups {
+			groups = append(groups, groupInfo{g.name, g.rects, nil})
+		}
+	} else {
+		for _, g := range additiveSheets[sheetIndex-len(sheets)].groups {
+			groups = append(groups, groupInfo{g.name, g.rects, g.indexed})
+		}
+	}
+
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\n\tstruct Position_t\n\t{\n")
+	fmt.Fprintf(out, "\t\tint x, y;\n")
+	fmt.Fprintf(out, "\t};\n")
+
+	for _, g := range groups {
+		fmt.Fprintf(out, "\n\t// %s group; members are numbered starting at 1 in sequence names, and at 0 in these arrays\n", g.name)
+		fmt.Fprintf(out, "\tconst int NUM_%s = %d;\n", g.name, len(g.rects))
+		fmt.Fprintf(out, "\tconst Position_t %s_Positions[NUM_%s] =\n\t{\n", g.name, g.name)
+		for _, r := range g.rects {
+			fmt.Fprintf(out, "\t\t{ %d, %d },\n", r.Min.X, r.Min.Y)
+		}
+		fmt.Fprintf(out, "\t};\n")
+
+		for _, f := range g.indexed {
+			members := make([]string, len(f.members))
+			for i, m := range f.members {
+				members[i] = strconv.Itoa(m)
+			}
+
+			fmt.Fprintf(out, "\n\t// for members %s\n", strings.Join(members, ", "))
+			fmt.Fprintf(out, "\tconst Sequence_t UV_%s%s_N[%d] =\n\t{\n", g.name, f.frame.suffix, len(f.members))
+			for _, m := range f.members {
+				fmt.Fprintf(out, "\t\tUV_%s%s,\n", g.name, f.indexedSuffix(m))
+			}
+			fmt.Fprintf(out, "\t};\n")
+		}
+	}
+}
+
+// formatFloat formats f so that it is always a valid C++ floating point literal when followed by an f suffix.
+func formatFloat(f float64) string {
+	s := fmt.Sprintf("%.6g", f)
+	for _, c := range s {
+		if c == '.' || c == 'e' {
+			return s
+		}
+	}
+
+	return s + ".0"
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// The additive frame suffixes describe which element is being hovered:
+//
+//   - "_hover" is the area itself
+//   - "_above_hover", "_below_hover", "_left_hover", and "_right_hover" are
+//     the neighboring area in that direction
+//   - "_<area>_hover" is the named area; a trailing "_<n>" is ignored so that
+//     several crops for the same target can have distinct names
+//   - "_<name>_glow" is any area whose name is name, or starts or ends with
+//     "_<name>"; the top bar glows the same way for every one of them
+//
+// Anything else is not a hover overlay.
+type hoverRelation int
+
+const (
+	hoverNone hoverRelation = iota
+	hoverSelf
+	hoverAbove
+	hoverBelow
+	hoverLeft
+	hoverRight
+	hoverNamed
+	hoverGlow
+)
+
+func (r hoverRelation) String() string {
+	switch r {
+	case hoverNone:
+		return "none"
+	case hoverSelf:
+		return "self"
+	case hoverAbove:
+		return "above"
+	case hoverBelow:
+		return "below"
+	case hoverLeft:
+		return "left"
+	case hoverRight:
+		return "right"
+	case hoverNamed:
+		return "named"
+	case hoverGlow:
+		return "glow"
+	}
+
+	return fmt.Sprintf("hoverRelation(%d)", int(r))
+}
+
+type hoverOverlay struct {
+	sequence string
+	area     int
+	frame    additiveFrame
+	relation hoverRelation
+	// for hoverNamed and hoverGlow, the name of the hovered area as written in the suffix
+	named string
+	// the hovered area instance, or -1 if it could not be determined
+	target int
+	// for hoverGlow, every area instance that lights up the glow; target is the first one
+	glowTargets []int
+}
+
+type hoverGraph struct {
+	sheet    *additiveSheet
+	ids      []string
+	overlays []hoverOverlay
+}
+
+// buildHoverGraph determines which area is hovered for each additive frame in a sheet.
+func buildHoverGraph(s *additiveSheet) *hoverGraph {
+	g := &hoverGraph{
+		sheet: s,
+		ids:   areaInstanceIDs(s.areas),
+	}
+
+	names := make(map[string][]int)
+	for i, a := range s.areas {
+		names[a.name] = append(names[a.name], i)
+	}
+
+	// frames in which each area instance is known to be hovered
+	hoveredIn := make([]map[int]bool, len(s.areas))
+	for i := range hoveredIn {
+		hoveredIn[i] = make(map[int]bool)
+	}
+
+	for i, a := range s.areas {
+		for _, f := range a.frames {
+			o := hoverOverlay{
+				sequence: a.name + f.suffix,
+				area:     i,
+				frame:    f,
+				target:   -1,
+			}
+			o.relation, o.named = parseHoverSuffix(f.suffix)
+
+			switch o.relation {
+			case hoverSelf:
+				o.target = i
+			case hoverAbove, hoverBelow, hoverLeft, hoverRight:
+				o.target = g.neighbor(i, o.relation)
+			case hoverGlow:
+				for j, b := range s.areas {
+					if b.name == o.named || strings.HasPrefix(b.name, o.named+"_") || strings.HasSuffix(b.name, "_"+o.named) {
+						o.glowTargets = append(o.glowTargets, j)
+					}
+				}
+				if len(o.glowTargets) != 0 {
+					o.target = o.glowTargets[0]
+				}
+			}
+
+			if o.target != -1 && !isGenerated(s.name, o.sequence) {
+				hoveredIn[o.target][frameNumber(f.render)] = true
+			}
+
+			g.overlays = append(g.overlays, o)
+		}
+	}
+
+	for i := range g.overlays {
+		o := &g.overlays[i]
+		if o.relation != hoverNamed {
+			continue
+		}
+
+		candidates := names[o.named]
+		if len(candidates) == 0 {
+			continue
+		}
+
+		// prefer the instance that other overlays say is hovered in the same frame
+		var hovered []int
+		for _, c := range candidates {
+			if hoveredIn[c][frameNumber(o.frame.render)] {
+				hovered = append(hovered, c)
+			}
+		}
+		if len(hovered) != 0 {
+			candidates = hovered
+		}
+
+		// otherwise, the closest one
+		o.target = candidates[0]
+		for _, c := range candidates[1:] {
+			if rectDistance(s.areas[c].rect, s.areas[o.area].rect) < rectDistance(s.areas[o.target].rect, s.areas[o.area].rect) {
+				o.target = c
+			}
+		}
+	}
+
+	return g
+}
+
+// areaInstanceIDs returns a unique name for each area. Areas that share a name
+// with other areas are numbered starting at 1.
+func areaInstanceIDs(areas []additiveArea) []string {
+	names := make([]string, len(areas))
+	for i, a := range areas {
+		names[i] = a.name
+	}
+
+	return instanceIDs(names)
+}
+
+func instanceIDs(names []string) []string {
+	count := make(map[string]int)
+	for _, name := range names {
+		count[name]++
+	}
+
+	seen := make(map[string]int)
+	ids := make([]string, len(names))
+	for i, name := range names {
+		if count[name] == 1 {
+			ids[i] = name
+			continue
+		}
+
+		seen[name]++
+		ids[i] = name + "_" + strconv.Itoa(seen[name])
+	}
+
+	return ids
+}
+
+func parseHoverSuffix(suffix string) (hoverRelation, string) {
+	s := strings.TrimPrefix(suffix, "_")
+
+	if i := strings.LastIndexByte(s, '_'); i != -1 {
+		if _, err := strconv.Atoi(s[i+1:]); err == nil {
+			s = s[:i]
+		}
+	}
+
+	if s == "hover" {
+		return hoverSelf, ""
+	}
+
+	if name, ok := strings.CutSuffix(s, "_glow"); ok && name != "" {
+		return hoverGlow, name
+	}
+
+	if !strings.HasSuffix(s, "_hover") {
+		return hoverNone, ""
+	}
+
+	switch s = strings.TrimSuffix(s, "_hover"); s {
+	case "above":
+		return hoverAbove, ""
+	case "below":
+		return hoverBelow, ""
+	case "left":
+		return hoverLeft, ""
+	case "right":
+		return hoverRight, ""
+	}
+
+	return hoverNamed, s
+}
+
+// neighbor returns the closest area in the given direction from area i that
+// does not overlap it, or -1 if there is none.
+func (g *hoverGraph) neighbor(i int, dir hoverRelation) int {
+	a := g.sheet.areas[i].rect
+	best, bestGap, bestOverlap := -1, 0, 0
+
+	for j, b := range g.sheet.areas {
+		if j == i || b.rect.Overlaps(a) {
+			continue
+		}
+
+		var gap, overlap int
+		switch dir {
+		case hoverAbove:
+			gap, overlap = a.Min.Y-b.rect.Max.Y, spanOverlap(a.Min.X, a.Max.X, b.rect.Min.X, b.rect.Max.X)
+		case hoverBelow:
+			gap, overlap = b.rect.Min.Y-a.Max.Y, spanOverlap(a.Min.X, a.Max.X, b.rect.Min.X, b.rect.Max.X)
+		case hoverLeft:
+			gap, overlap = a.Min.X-b.rect.Max.X, spanOverlap(a.Min.Y, a.Max.Y, b.rect.Min.Y, b.rect.Max.Y)
+		case hoverRight:
+			gap, overlap = b.rect.Min.X-a.Max.X, spanOverlap(a.Min.Y, a.Max.Y, b.rect.Min.Y, b.rect.Max.Y)
+		default:
+			panic("not a direction: " + dir.String())
+		}
+
+		if gap < 0 || overlap <= 0 {
+			continue
+		}
+
+		if best != -1 {
+			if gap > bestGap {
+				continue
+			}
+
+			if gap == bestGap {
+				// prefer another copy of the same element, then the one that lines up best
+				sameBest := g.sheet.areas[best].name == g.sheet.areas[i].name
+				same := b.name == g.sheet.areas[i].name
+				if sameBest && !same || sameBest == same && overlap <= bestOverlap {
+					continue
+				}
+			}
+		}
+
+		best, bestGap, bestOverlap = j, gap, overlap
+	}
+
+	return best
+}
+
+// placements returns the overlays to draw when the given area instance is hovered, and where to draw them.
+//
+// Overlays for the hovered area itself and for its neighbors are shared by
+// every area with the same name, so they are drawn relative to the hovered
+// instance, as long as the hovered area is the same kind of element as the
+// one the overlay was cropped for. Overlays for a named area, and glows, are
+// only drawn where they were cropped.
+func (g *hoverGraph) placements(target int) []hoverPlacement {
+	var placements []hoverPlacement
+
+	for _, o := range g.overlays {
+		name := g.sheet.areas[o.area].name
+
+		switch o.relation {
+		case hoverSelf:
+			if g.sheet.areas[target].name == name {
+				placements = append(placements, hoverPlacement{o, target})
+			}
+		case hoverAbove, hoverBelow, hoverLeft, hoverRight:
+			if o.target == -1 || g.sheet.areas[o.target].name != g.sheet.areas[target].name {
+				continue
+			}
+
+			for i, a := range g.sheet.areas {
+				if a.name == name && g.neighbor(i, o.relation) == target {
+					placements = append(placements, hoverPlacement{o, i})
+				}
+			}
+		case hoverNamed:
+			if o.target == target {
+				placements = append(placements, hoverPlacement{o, o.area})
+			}
+		case hoverGlow:
+			for _, t := range o.glowTargets {
+				if t == target {
+					placements = append(placements, hoverPlacement{o, o.area})
+				}
+			}
+		}
+	}
+
+	return placements
+}
+
+type hoverPlacement struct {
+	overlay hoverOverlay
+	area    int
+}
+
+// targets returns the area instances that have at least one overlay.
+func (g *hoverGraph) targets() []int {
+	var targets []int
+	for i := range g.sheet.areas {
+		if len(g.placements(i)) != 0 {
+			targets = append(targets, i)
+		}
+	}
+
+	return targets
+}
+
+func (g *hoverGraph) lookup(id string) (int, error) {
+	for i, candidate := range g.ids {
+		if candidate == id {
+			return i, nil
+		}
+	}
+
+	var group []string
+	for i, a := range g.sheet.areas {
+		if a.name == id {
+			group = append(group, g.ids[i])
+		}
+	}
+	if len(group) != 0 {
+		return -1, fmt.Errorf("%q is used by %d areas in %s; use one of: %s", id, len(group), g.sheet.name, strings.Join(group, ", "))
+	}
+
+	return -1, fmt.Errorf("no area named %q in %s", id, g.sheet.name)
+}
+
+func spanOverlap(aMin, aMax, bMin, bMax int) int {
+	if aMin < bMin {
+		aMin = bMin
+	}
+	if aMax > bMax {
+		aMax = bMax
+	}
+
+	return aMax - aMin
+}
+
+func rectDistance(a, b image.Rectangle) int {
+	dx := (a.Min.X + a.Max.X - b.Min.X - b.Max.X) / 2
+	dy := (a.Min.Y + a.Max.Y - b.Min.Y - b.Max.Y) / 2
+
+	return dx*dx + dy*dy
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+)
+
+type jsonRect struct {
+	X0 int `json:"x0"`
+	Y0 int `json:"y0"`
+	X1 int `json:"x1"`
+	Y1 int `json:"y1"`
+}
+
+func toJSONRect(r image.Rectangle) jsonRect {
+	return jsonRect{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y}
+}
+
+type hoverTable struct {
+	Sheet   string             `json:"sheet"`
+	Enum    string             `json:"enum"`
+	Targets []hoverTableTarget `json:"targets"`
+}
+
+type hoverTableTarget struct {
+	Name     string              `json:"name"`
+	Area     string              `json:"area"`
+	Rect     jsonRect            `json:"rect"`
+	Overlays []hoverTableOverlay `json:"overlays"`
+}
+
+type hoverTableOverlay struct {
+	Sequence  int      `json:"sequence"`
+	Name      string   `json:"name"`
+	BaseFrame int      `json:"base_frame"`
+	Rect      jsonRect `json:"rect"`
+}
+
+// buildHoverTable lists, for each area that can be hovered, the additive sequences to draw and where to draw them.
+func buildHoverTable(additiveIndex int) *hoverTable {
+	s := &additiveSheets[additiveIndex]
+	g := buildHoverGraph(s)
+
+	indices := make(map[string]int)
+	for i, name := range sheetSequenceNames(len(sheets) + additiveIndex) {
+		indices[name] = i
+	}
+
+	t := &hoverTable{
+		Sheet:   s.name,
+		Enum:    s.enum,
+		Targets: []hoverTableTarget{},
+	}
+
+	for _, target := range g.targets() {
+		tt := hoverTableTarget{
+			Name: g.ids[target],
+			Area: s.areas[target].name,
+			Rect: toJSONRect(s.areas[target].rect),
+		}
+
+		for _, p := range g.placements(target) {
+			tt.Overlays = append(tt.Overlays, hoverTableOverlay{
+				Sequence:  indices[p.overlay.sequence],
+				Name:      p.overlay.sequence,
+				BaseFrame: frameNumber(p.overlay.frame.base),
+				Rect:      toJSONRect(s.areas[p.area].rect),
+			})
+		}
+
+		t.Targets = append(t.Targets, tt)
+	}
+
+	return t
+}
+
+func writeHoverTable(additiveIndex int) {
+	t := buildHoverTable(additiveIndex)
+
+	b, err := json.MarshalIndent(t, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.WriteFile(outputPath(t.Sheet+"_hover.json"), append(b, '\n'), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	out, err := os.Create(outputPath(t.Sheet + "_hover.h"))
+	if err != nil {
+		panic(err)
+	}
+
+	guard := includeGuard(t.Sheet + "_hover_h")
+	fmt.Fprintf(out, "// generated by sliceanddice from additiveSheets; do not edit\n\n")
+	fmt.Fprintf(out, "#ifndef %s\n#define %s\n#pragma once\n\n", guard, guard)
+	fmt.Fprintf(out, "struct %sHoverOverlay_t\n{\n\tint iSequence;\n\t// only draw the overlay while the base sequences from this render frame are shown\n\tint iBaseFrame;\n\tint x0, y0, x1, y1;\n};\n\n", t.Enum)
+	fmt.Fprintf(out, "struct %sHoverTarget_t\n{\n\tconst char *szName;\n\tint x0, y0, x1, y1;\n\tint iFirstOverlay;\n\tint nOverlays;\n};\n\n", t.Enum)
+
+	fmt.Fprintf(out, "static const %sHoverOverlay_t s_%sHoverOverlays[] =\n{\n", t.Enum, t.Enum)
+	for _, tt := range t.Targets {
+		fmt.Fprintf(out, "\t// %s\n", tt.Name)
+		for _, o := range tt.Overlays {
+			fmt.Fprintf(out, "\t{ %d, %d, %d, %d, %d, %d }, // %s\n", o.Sequence, o.BaseFrame, o.Rect.X0, o.Rect.Y0, o.Rect.X1, o.Rect.Y1, o.Name)
+		}
+	}
+	fmt.Fprintf(out, "};\n\n")
+
+	fmt.Fprintf(out, "static const %sHoverTarget_t s_%sHoverTargets[] =\n{\n", t.Enum, t.Enum)
+	first := 0
+	for _, tt := range t.Targets {
+		fmt.Fprintf(out, "\t{ %q, %d, %d, %d, %d, %d, %d },\n", tt.Name, tt.Rect.X0, tt.Rect.Y0, tt.Rect.X1, tt.Rect.Y1, first, len(tt.Overlays))
+		first += len(tt.Overlays)
+	}
+	fmt.Fprintf(out, "};\n\n#endif // %s\n", guard)
+
+	err = out.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func includeGuard(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			b[i] = c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9' && i != 0:
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
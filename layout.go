@@ -0,0 +1,106 @@
+package main
+
+import (
+	"image"
+)
+
+// the layout tables as written, before loadLayout changes them
+var (
+	declaredSheets         = cloneSheets(sheets[:])
+	declaredAdditiveSheets = cloneAdditiveSheets(additiveSheets)
+)
+
+// loadLayout resets the layout tables to the way they are written, resolves
+// the frame names, applies the rectangles from the .blend file and the region
+// map, if there are any, expands the area groups, and adds the generated
+// hovers. It must be called before anything uses the layout tables.
+func loadLayout() error {
+	copy(sheets[:], cloneSheets(declaredSheets))
+	additiveSheets = cloneAdditiveSheets(declaredAdditiveSheets)
+
+	err := loadFrameNames()
+	if err != nil {
+		return err
+	}
+
+	if *blendLayout != "" {
+		err = applyBlendLayout()
+		if err != nil {
+			return err
+		}
+	}
+
+	if *regionMap != "" {
+		err = applyRegionMap()
+		if err != nil {
+			return err
+		}
+	}
+
+	expandGroups()
+
+	return addGeneratedHovers()
+}
+
+func cloneSheets(s []sheet) []sheet {
+	clone := make([]sheet, len(s))
+	for i := range s {
+		clone[i] = s[i]
+		clone[i].areas = append([]area(nil), s[i].areas...)
+		clone[i].groups = append([]areaGroup(nil), s[i].groups...)
+		for j := range clone[i].groups {
+			clone[i].groups[j].rects = append([]image.Rectangle(nil), s[i].groups[j].rects...)
+		}
+	}
+
+	return clone
+}
+
+func cloneAdditiveSheets(s []additiveSheet) []additiveSheet {
+	clone := make([]additiveSheet, len(s))
+	for i := range s {
+		clone[i] = s[i]
+		clone[i].areas = append([]additiveArea(nil), s[i].areas...)
+		clone[i].groups = append([]additiveAreaGroup(nil), s[i].groups...)
+		for j := range clone[i].groups {
+			clone[i].groups[j].rects = append([]image.Rectangle(nil), s[i].groups[j].rects...)
+		}
+	}
+
+	return clone
+}
+
+// layoutRects returns the instance ID and a pointer to the rectangle of every
+// area in a sheet, in the order they will be in after the groups are expanded.
+func layoutRects(sheetIndex int) ([]string, []*image.Rectangle) {
+	var names []string
+	var rects []*image.Rectangle
+
+	if sheetIndex < len(sheets) {
+		s := &sheets[sheetIndex]
+		for i := range s.areas {
+			names = append(names, s.areas[i].name)
+			rects = append(rects, &s.areas[i].rect)
+		}
+		for _, g := range s.groups {
+			for i := range g.rects {
+				names = append(names, g.name)
+				rects = append(rects, &g.rects[i])
+			}
+		}
+	} else {
+		s := &additiveSheets[sheetIndex-len(sheets)]
+		for i := range s.areas {
+			names = append(names, s.areas[i].name)
+			rects = append(rects, &s.areas[i].rect)
+		}
+		for _, g := range s.groups {
+			for i := range g.rects {
+				names = append(names, g.name)
+				rects = append(rects, &g.rects[i])
+			}
+		}
+	}
+
+	return instanceIDs(names), rects
+}
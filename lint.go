@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type hoverEdge struct {
+	target, area int
+}
+
+func lint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	dot := fs.String("dot", "", "write the hover graph in Graphviz DOT format to this file")
+	frames := fs.Bool("frames", false, "also check that every render frame the layout uses exists")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	problems := validateLayout(nil, *frames)
+	var graphs []*hoverGraph
+	for i := range additiveSheets {
+		g := buildHoverGraph(&additiveSheets[i])
+		graphs = append(graphs, g)
+		problems = append(problems, g.lint()...)
+	}
+
+	if *dot != "" {
+		out, err := os.Create(*dot)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, g := range graphs {
+			g.writeDOT(out)
+		}
+
+		err = out.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) != 0 {
+		fmt.Printf("%d problems found\n", len(problems))
+		os.Exit(1)
+	}
+}
+
+// edges returns, for each hover target, the other areas that get an overlay when it is hovered.
+func (g *hoverGraph) edges() map[hoverEdge][]hoverOverlay {
+	edges := make(map[hoverEdge][]hoverOverlay)
+	for target := range g.sheet.areas {
+		for _, p := range g.placements(target) {
+			if p.area != target {
+				e := hoverEdge{target, p.area}
+				edges[e] = append(edges[e], p.overlay)
+			}
+		}
+	}
+
+	return edges
+}
+
+func (g *hoverGraph) lint() []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, g.sheet.name+": "+fmt.Sprintf(format, args...))
+	}
+
+	used := make(map[string]bool)
+	for target := range g.sheet.areas {
+		for _, p := range g.placements(target) {
+			used[p.overlay.sequence] = true
+		}
+	}
+
+	for _, o := range g.overlays {
+		switch {
+		case o.relation == hoverNone:
+			report("%s: suffix %q is not a hover or glow overlay", o.sequence, o.frame.suffix)
+		case (o.relation == hoverNamed || o.relation == hoverGlow) && o.target == -1:
+			report("%s: refers to %q, which is not an area", o.sequence, o.named)
+		case o.target == -1:
+			report("%s: %s (%s) has no neighbor %s it", o.sequence, g.ids[o.area], g.sheet.areas[o.area].rect, directionPhrase(o.relation))
+		case !used[o.sequence]:
+			report("%s: never drawn for any hovered area", o.sequence)
+		}
+	}
+
+	hoverable := make(map[int]bool)
+	for _, target := range g.targets() {
+		hoverable[target] = true
+	}
+
+	// only complain about missing reverse relationships for areas that can be hovered at all
+	edges := g.edges()
+	var asymmetric []hoverEdge
+	for e := range edges {
+		if _, ok := edges[hoverEdge{e.area, e.target}]; !ok && hoverable[e.area] {
+			asymmetric = append(asymmetric, e)
+		}
+	}
+	sort.Slice(asymmetric, func(i, j int) bool {
+		if asymmetric[i].target != asymmetric[j].target {
+			return asymmetric[i].target < asymmetric[j].target
+		}
+		return asymmetric[i].area < asymmetric[j].area
+	})
+	for _, e := range asymmetric {
+		var names []string
+		for _, o := range edges[e] {
+			names = append(names, o.sequence)
+		}
+		report("hovering %s affects %s (%s), but hovering %s does not affect %s", g.ids[e.target], g.ids[e.area], strings.Join(names, ", "), g.ids[e.area], g.ids[e.target])
+	}
+
+	frameUsers := make(map[int]map[int]bool)
+	for _, o := range g.overlays {
+		if isGenerated(g.sheet.name, o.sequence) {
+			continue
+		}
+
+		index := frameNumber(o.frame.render)
+		if frameUsers[index] == nil {
+			frameUsers[index] = make(map[int]bool)
+		}
+		frameUsers[index][o.area] = true
+	}
+	var frames []int
+	for index := range frameUsers {
+		frames = append(frames, index)
+	}
+	sort.Ints(frames)
+	for _, index := range frames {
+		if len(frameUsers[index]) != 1 {
+			continue
+		}
+
+		for area := range frameUsers[index] {
+			report("render frame %d (%s) is only used by %s", index, frameNamesOf(index), g.ids[area])
+		}
+	}
+
+	return problems
+}
+
+func directionPhrase(r hoverRelation) string {
+	switch r {
+	case hoverAbove:
+		return "above"
+	case hoverBelow:
+		return "below"
+	case hoverLeft:
+		return "to the left of"
+	case hoverRight:
+		return "to the right of"
+	}
+
+	return r.String()
+}
+
+func (g *hoverGraph) writeDOT(w io.Writer) {
+	fmt.Fprintf(w, "digraph %q {\n", g.sheet.name)
+	fmt.Fprintf(w, "\tnode [shape=box];\n")
+	for i, a := range g.sheet.areas {
+		fmt.Fprintf(w, "\t%q [label=%q];\n", g.ids[i], fmt.Sprintf("%s\n%v", g.ids[i], a.rect))
+	}
+
+	edges := g.edges()
+	var keys []hoverEdge
+	for e := range edges {
+		keys = append(keys, e)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].target != keys[j].target {
+			return keys[i].target < keys[j].target
+		}
+		return keys[i].area < keys[j].area
+	})
+
+	for _, e := range keys {
+		for _, o := range edges[e] {
+			style := "solid"
+			switch o.relation {
+			case hoverGlow:
+				style = "dotted"
+			case hoverNamed:
+			default:
+				style = "dashed"
+			}
+			fmt.Fprintf(w, "\t%q -> %q [label=%q, style=%s];\n", g.ids[e.target], g.ids[e.area], fmt.Sprintf("%s (%s)", o.sequence, o.frame.render), style)
+		}
+	}
+
+	for _, o := range g.overlays {
+		if o.target == -1 && o.relation != hoverNone {
+			fmt.Fprintf(w, "\t%q [shape=plaintext, fontcolor=red];\n", "?"+o.sequence)
+			fmt.Fprintf(w, "\t%q -> %q [color=red];\n", "?"+o.sequence, g.ids[o.area])
+		}
+	}
+
+	fmt.Fprintf(w, "}\n")
+}
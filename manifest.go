@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+)
+
+type sheetManifest struct {
+	Sheet     string             `json:"sheet"`
+	Enum      string             `json:"enum"`
+	Additive  bool               `json:"additive"`
+	Width     int                `json:"width"`
+	Height    int                `json:"height"`
+	Sequences []sequenceManifest `json:"sequences"`
+}
+
+type sequenceManifest struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	// "base" or "additive"
+	Kind string `json:"kind"`
+	// where the sequence is in the packed texture, in pixels
+	Atlas jsonRect `json:"atlas"`
+	// the texture coordinates as written to the .sht file (u0, v0, u1, v1)
+	UV [4]float32 `json:"uv"`
+	// the area the sequence was cropped from, in render pixels
+	Source jsonRect `json:"source"`
+	// the render frames the sequence was cropped from; for additive sequences, the base frame comes first
+	Frames []int `json:"frames"`
+	// for sequences shared by the members of an area group, the area of each member in order
+	Instances []jsonRect `json:"instances,omitempty"`
+}
+
+// writeSheetManifest writes a human-readable description of a packed sheet.
+//
+// names and rects must be in the same order as the sequences in the .sht file.
+func writeSheetManifest(sheetIndex int, names []string, rects []image.Rectangle, w, h int) {
+	name, enumName := sheetNames(sheetIndex)
+	sources := sheetSequenceSources(sheetIndex)
+
+	m := &sheetManifest{
+		Sheet:     name,
+		Enum:      enumName,
+		Additive:  sheetIndex >= len(sheets),
+		Width:     w,
+		Height:    h,
+		Sequences: make([]sequenceManifest, len(names)),
+	}
+
+	for i, n := range names {
+		src := sources[n]
+		kind := "base"
+		if src.additive {
+			kind = "additive"
+		}
+
+		var instances []jsonRect
+		for _, r := range src.instances {
+			instances = append(instances, toJSONRect(r))
+		}
+
+		m.Sequences[i] = sequenceManifest{
+			Index:     i,
+			Name:      n,
+			Kind:      kind,
+			Atlas:     toJSONRect(rects[i]),
+			UV:        sheetUV(rects[i], w, h),
+			Source:    toJSONRect(src.rect),
+			Frames:    src.frames,
+			Instances: instances,
+		}
+	}
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.WriteFile(outputPath(name+"_manifest.json"), append(b, '\n'), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// maskPath returns the mask image for an additive area instance, or "" if
+// -mask-dir is not set. The file doesn't have to exist.
+func maskPath(id string) string {
+	if *maskDir == "" {
+		return ""
+	}
+
+	return filepath.Join(*maskDir, id+".png")
+}
+
+// hasMask returns true if an additive area instance has a mask polygon or image.
+func hasMask(id string) bool {
+	if _, ok := additiveMasks[id]; ok {
+		return true
+	}
+
+	if name := maskPath(id); name != "" {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// areaMask returns how much of the difference to keep at each pixel of an
+// additive area instance, from 0 to 1, or nil if the area has no mask.
+//
+// The mask image can either be the size of the area or the size of the
+// frame. White pixels are kept; black and transparent pixels are zeroed.
+func areaMask(id string, rect image.Rectangle) ([]float32, error) {
+	var mask []float32
+	w, h := rect.Dx(), rect.Dy()
+
+	if name := maskPath(id); name != "" {
+		img, err := readMaskImage(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if img != nil {
+			offset := rect.Min
+			switch img.Bounds().Size() {
+			case rect.Size():
+				offset = image.Point{}
+			case frameBounds.Size():
+			default:
+				return nil, fmt.Errorf("%s is %v, but should be the size of the area (%v) or of the frame (%v)", name, img.Bounds().Size(), rect.Size(), frameBounds.Size())
+			}
+			offset = offset.Add(img.Bounds().Min)
+
+			mask = make([]float32, w*h)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					// transparent pixels convert to black
+					g := color.Gray16Model.Convert(img.At(offset.X+x, offset.Y+y)).(color.Gray16)
+					mask[y*w+x] = float32(g.Y) / 0xffff
+				}
+			}
+		}
+	}
+
+	if poly, ok := additiveMasks[id]; ok {
+		if mask == nil {
+			mask = make([]float32, w*h)
+			for i := range mask {
+				mask[i] = 1
+			}
+		}
+
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if !polygonContains(poly, float64(rect.Min.X+x)+0.5, float64(rect.Min.Y+y)+0.5) {
+					mask[y*w+x] = 0
+				}
+			}
+		}
+	}
+
+	return mask, nil
+}
+
+// readMaskImage returns nil if the file does not exist.
+func readMaskImage(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return img, nil
+}
+
+// polygonContains uses the even-odd rule, so self-intersecting polygons
+// leave holes where they overlap.
+func polygonContains(poly []image.Point, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		xi, yi := float64(poly[i].X), float64(poly[i].Y)
+		xj, yj := float64(poly[j].X), float64(poly[j].Y)
+		if (yi > y) != (yj > y) && x < xi+(y-yi)*(xj-xi)/(yj-yi) {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// applyMask scales the color channels of an additive difference image by the
+// mask. Alpha comes from the base frame, so it is left alone.
+func applyMask(f *floatImage, mask []float32) {
+	if mask == nil {
+		return
+	}
+
+	for i, m := range mask {
+		for c := 0; c < 3; c++ {
+			f.Pix[i*4+c] *= m
+		}
+	}
+}
+
+// maskKey returns a string that changes whenever an additive area
+// instance's mask does.
+func (c *buildCache) maskKey(id string) (string, error) {
+	h := sha256.New()
+	if poly, ok := additiveMasks[id]; ok {
+		fmt.Fprintf(h, "polygon %v\n", poly)
+	}
+
+	if name := maskPath(id); name != "" {
+		if _, err := os.Stat(name); err == nil {
+			sum, err := c.fileHash(name)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "image %s\n", sum)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
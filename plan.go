@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// planCommand describes the work a build would do without reading any images.
+func planCommand(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	uses := make(map[int][]string)
+	for sheetIndex, r := range requestFrames() {
+		name, _ := sheetNames(sheetIndex)
+		for i, q := range r {
+			role := "base"
+			if sheetIndex >= len(sheets) {
+				// additive sequences are requested as a base frame followed by a hover frame
+				role = "additive base"
+				if i%2 == 1 {
+					role = "additive hover"
+					if q.glow {
+						role = "additive hover, from " + glowPath(q.index)
+					} else if q.generated.kind != glowNone {
+						role = "generated " + q.generated.kind.String()
+					}
+					if hasMask(q.area) {
+						role += ", masked"
+					}
+				}
+			}
+
+			uses[q.index] = append(uses[q.index], fmt.Sprintf("%s/%s (%s)", name, q.name, role))
+		}
+	}
+
+	frames := make([]int, 0, len(uses))
+	for i := range uses {
+		frames = append(frames, i)
+	}
+	sort.Ints(frames)
+
+	fmt.Println("frames:")
+
+	var missing, unused, negative []int
+	for _, i := range frames {
+		if i < 0 {
+			negative = append(negative, i)
+			fmt.Printf("  %4d  NEGATIVE\n", i)
+			for _, u := range uses[i] {
+				fmt.Printf("          %s\n", u)
+			}
+			continue
+		}
+
+		status := "ok"
+		if fi, err := (renderFile{i, false}).stat(); errors.Is(err, os.ErrNotExist) {
+			status = "MISSING"
+			missing = append(missing, i)
+		} else if err != nil {
+			status = err.Error()
+		} else if !fi.Mode().IsRegular() {
+			status = "not a file"
+		}
+
+		fmt.Printf("  %4d  %s  %s  %s\n", i, frameNamesOf(i), framePath(i), status)
+		for _, u := range uses[i] {
+			fmt.Printf("          %s\n", u)
+		}
+	}
+	if len(frames) != 0 {
+		for i := 0; i < frames[len(frames)-1]; i++ {
+			if _, ok := uses[i]; !ok {
+				unused = append(unused, i)
+			}
+		}
+	}
+
+	for sheetIndex := 0; sheetIndex < len(sheets)+len(additiveSheets); sheetIndex++ {
+		name, _ := sheetNames(sheetIndex)
+		sources := sheetSequenceSources(sheetIndex)
+		names := sheetSequenceNames(sheetIndex)
+
+		pixels := 0
+		for _, n := range names {
+			pixels += sources[n].rect.Dx() * sources[n].rect.Dy()
+		}
+
+		fmt.Printf("\n%s: %d sequences, %d pixels before padding\n", name, len(names), pixels)
+		for i, n := range names {
+			src := sources[n]
+			fmt.Printf("  %3d  %-40s %4dx%-4d frames %v\n", i, n, src.rect.Dx(), src.rect.Dy(), src.frames)
+		}
+	}
+
+	if len(frames) == 0 {
+		fmt.Printf("\nno frames referenced\n")
+	} else {
+		fmt.Printf("\n%d frames referenced (%d through %d)\n", len(frames), frames[0], frames[len(frames)-1])
+	}
+	if len(negative) != 0 {
+		fmt.Printf("negative: %v\n", negative)
+	}
+	if len(unused) != 0 {
+		fmt.Printf("not needed: %v\n", unused)
+	}
+	if len(missing) != 0 {
+		fmt.Printf("missing: %v\n", missing)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/ftrvxmtrx/tga"
+)
+
+type builtSheet struct {
+	name  string
+	tex   *image.NRGBA
+	rects map[string]image.Rectangle
+}
+
+// loadBuiltSheet reads a sheet's .tga and .sht files back in.
+func loadBuiltSheet(sheetIndex int) (*builtSheet, error) {
+	name, _ := sheetNames(sheetIndex)
+
+	f, err := os.Open(outputPath(name + ".tga"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := tga.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s.tga: %w", name, err)
+	}
+
+	tex, ok := img.(*image.NRGBA)
+	if !ok {
+		tex = image.NewNRGBA(img.Bounds())
+		draw.Draw(tex, tex.Rect, img, img.Bounds().Min, draw.Src)
+	}
+
+	sheetData, err := os.ReadFile(outputPath(name + ".sht"))
+	if err != nil {
+		return nil, err
+	}
+
+	rects, err := parseSheetData(sheetData, tex.Rect.Dx(), tex.Rect.Dy())
+	if err != nil {
+		return nil, fmt.Errorf("%s.sht: %w", name, err)
+	}
+
+	names := sheetSequenceNames(sheetIndex)
+	if len(rects) != len(names) {
+		return nil, fmt.Errorf("%s.sht has %d sequences, but the layout has %d (is the sheet out of date?)", name, len(rects), len(names))
+	}
+
+	s := &builtSheet{
+		name:  name,
+		tex:   tex,
+		rects: make(map[string]image.Rectangle, len(names)),
+	}
+	for i, n := range names {
+		s.rects[n] = rects[i]
+	}
+
+	return s, nil
+}
+
+func loadBuiltSheets() ([]*builtSheet, error) {
+	built := make([]*builtSheet, len(sheets)+len(additiveSheets))
+	for i := range built {
+		var err error
+		built[i], err = loadBuiltSheet(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return built, nil
+}
+
+// parseSheetData converts the UV rectangles written by packSheet back into pixel coordinates.
+func parseSheetData(b []byte, w, h int) ([]image.Rectangle, error) {
+	readInt := func() (uint32, error) {
+		if len(b) < 4 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		i := binary.LittleEndian.Uint32(b)
+		b = b[4:]
+		return i, nil
+	}
+	readFloat := func() (float32, error) {
+		i, err := readInt()
+		return math.Float32frombits(i), err
+	}
+
+	version, err := readInt()
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported sheet version %d", version)
+	}
+
+	count, err := readInt()
+	if err != nil {
+		return nil, err
+	}
+
+	rects := make([]image.Rectangle, count)
+	for i := range rects {
+		var header [3]uint32
+		for j := range header {
+			if header[j], err = readInt(); err != nil {
+				return nil, err
+			}
+		}
+		if header[0] != uint32(i) {
+			return nil, fmt.Errorf("sequence %d has index %d", i, header[0])
+		}
+		if header[2] != 1 {
+			return nil, fmt.Errorf("sequence %d has %d frames", i, header[2])
+		}
+
+		// total sequence time, frame time, then four copies of the UV rectangle
+		var floats [2 + 4*4]float32
+		for j := range floats {
+			if floats[j], err = readFloat(); err != nil {
+				return nil, err
+			}
+		}
+
+		rects[i] = image.Rect(
+			int(math.Round(float64(floats[2]*float32(w)-0.5))),
+			int(math.Round(float64(floats[3]*float32(h)-0.5))),
+			int(math.Round(float64(floats[4]*float32(w)+0.5))),
+			int(math.Round(float64(floats[5]*float32(h)+0.5))),
+		)
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("unexpected data after last sequence")
+	}
+
+	return rects, nil
+}
+
+// renderPreview composites the built sheets back into a full menu image.
+//
+// hover is an area instance ID as returned by areaInstanceIDs, or the empty
+// string to show the menu without anything hovered. If onlyFrame is not -1,
+// only the sequences cropped from that render frame are drawn.
+func renderPreview(built []*builtSheet, onlyFrame int, hover string) (*image.RGBA, error) {
+	canvas := image.NewRGBA(frameBounds)
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	for i, s := range sheets {
+		for _, a := range s.areas {
+			isBase := false
+			for _, f := range a.frames {
+				if f.suffix == "" && (onlyFrame == -1 || frameNumber(f.render) == onlyFrame) {
+					isBase = true
+				}
+			}
+			if !isBase {
+				continue
+			}
+
+			src, err := built[i].sequence(a.name, a.rect)
+			if err != nil {
+				return nil, err
+			}
+
+			draw.Draw(canvas, a.rect, src, src.Rect.Min, draw.Over)
+		}
+	}
+
+	if hover == "" {
+		return canvas, nil
+	}
+
+	found := false
+	var lookupErr error
+	for i := range additiveSheets {
+		g := buildHoverGraph(&additiveSheets[i])
+		target, err := g.lookup(hover)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+		found = true
+
+		for _, p := range g.placements(target) {
+			if onlyFrame != -1 && frameNumber(p.overlay.frame.base) != onlyFrame {
+				continue
+			}
+
+			rect := g.sheet.areas[p.area].rect
+			src, err := built[len(sheets)+i].sequence(p.overlay.sequence, rect)
+			if err != nil {
+				return nil, err
+			}
+
+			drawAdditive(canvas, rect, src)
+		}
+	}
+
+	if !found {
+		return nil, lookupErr
+	}
+
+	return canvas, nil
+}
+
+// parseFrameFilter is like parseFrame, but returns -1 for the empty string.
+func parseFrameFilter(s string) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+
+	return parseFrame(s)
+}
+
+func (s *builtSheet) sequence(name string, dest image.Rectangle) (*image.NRGBA, error) {
+	rect, ok := s.rects[name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no sequence named %q", s.name, name)
+	}
+	if rect.Size() != dest.Size() {
+		return nil, fmt.Errorf("%s sequence %q is %v, but the area is %v (is the sheet out of date?)", s.name, name, rect.Size(), dest.Size())
+	}
+
+	return s.tex.SubImage(rect).(*image.NRGBA), nil
+}
+
+// drawAdditive blends src onto dst the same way the game draws an $additive material.
+func drawAdditive(dst *image.RGBA, r image.Rectangle, src *image.NRGBA) {
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			s := src.NRGBAAt(src.Rect.Min.X+x, src.Rect.Min.Y+y)
+			d := dst.RGBAAt(r.Min.X+x, r.Min.Y+y)
+			d.R = addByte(d.R, s.R)
+			d.G = addByte(d.G, s.G)
+			d.B = addByte(d.B, s.B)
+			dst.SetRGBA(r.Min.X+x, r.Min.Y+y, d)
+		}
+	}
+}
+
+func addByte(a, b uint8) uint8 {
+	if int(a)+int(b) > 255 {
+		return 255
+	}
+
+	return a + b
+}
+
+func preview(args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	onlyName := fs.String("frame", "", "only show the sequences cropped from this render frame (name or number); by default every base sequence is shown")
+	hover := fs.String("hover", "", "area to show as hovered (for example create_lobby or quick_join_2)")
+	all := fs.Bool("all", false, "write one image per hover state instead of a single image")
+	output := fs.String("o", "", "output file (default preview.png), or output directory with -all (default preview)")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	onlyFrame, err := parseFrameFilter(*onlyName)
+	if err != nil {
+		panic(err)
+	}
+
+	built, err := loadBuiltSheets()
+	if err != nil {
+		panic(err)
+	}
+
+	if !*all {
+		if *output == "" {
+			*output = "preview.png"
+		}
+
+		img, err := renderPreview(built, onlyFrame, *hover)
+		if err != nil {
+			panic(err)
+		}
+
+		writePNG(*output, img)
+
+		return
+	}
+
+	if *hover != "" {
+		panic("-hover and -all cannot be used together")
+	}
+	if *output == "" {
+		*output = "preview"
+	}
+
+	err = os.MkdirAll(*output, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	img, err := renderPreview(built, onlyFrame, "")
+	if err != nil {
+		panic(err)
+	}
+
+	writePNG(filepath.Join(*output, "preview.png"), img)
+
+	for i := range additiveSheets {
+		g := buildHoverGraph(&additiveSheets[i])
+		for _, target := range g.targets() {
+			img, err := renderPreview(built, onlyFrame, g.ids[target])
+			if err != nil {
+				panic(err)
+			}
+
+			writePNG(filepath.Join(*output, "preview_"+g.ids[target]+".png"), img)
+		}
+	}
+}
+
+func writePNG(name string, img image.Image) {
+	fmt.Printf("writing %q\n", name)
+
+	out, err := os.Create(name)
+	if err != nil {
+		panic(err)
+	}
+
+	err = png.Encode(out, img)
+	if err != nil {
+		panic(err)
+	}
+
+	err = out.Close()
+	if err != nil {
+		panic(err)
+	}
+}
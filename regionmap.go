@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type regionEntry struct {
+	color uint32
+	name  string
+	line  int
+}
+
+// readRegionNames reads the color-to-area table for the region map. Each
+// line is a hex color (with or without a leading #) followed by an area
+// instance ID, such as "ff8000 hoiaf_top_10_3". Blank lines and lines
+// starting with // are ignored.
+func readRegionNames(name string) ([]regionEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []regionEntry
+	colors := make(map[uint32]int)
+	names := make(map[string]int)
+
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a color and an area name", name, line)
+		}
+
+		hex := strings.TrimPrefix(fields[0], "#")
+		c, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return nil, fmt.Errorf("%s:%d: %q is not a color in rrggbb format", name, line, fields[0])
+		}
+
+		if prev, ok := colors[uint32(c)]; ok {
+			return nil, fmt.Errorf("%s:%d: color %s is already used on line %d", name, line, fields[0], prev)
+		}
+		if prev, ok := names[fields[1]]; ok {
+			return nil, fmt.Errorf("%s:%d: area %s is already listed on line %d", name, line, fields[1], prev)
+		}
+		colors[uint32(c)], names[fields[1]] = line, line
+
+		entries = append(entries, regionEntry{uint32(c), fields[1], line})
+	}
+
+	return entries, s.Err()
+}
+
+// applyRegionMap replaces the rectangle of each area listed in the region
+// names table with the bounding box of its color in the region map.
+func applyRegionMap() error {
+	if *regionNames == "" {
+		return fmt.Errorf("-region-map requires -region-names")
+	}
+
+	entries, err := readRegionNames(*regionNames)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool)
+	for sheetIndex := 0; sheetIndex < len(sheets)+len(additiveSheets); sheetIndex++ {
+		ids, _ := layoutRects(sheetIndex)
+		for _, id := range ids {
+			known[id] = true
+		}
+	}
+	for _, e := range entries {
+		if !known[e.name] {
+			return fmt.Errorf("%s:%d: no area has the instance ID %q", *regionNames, e.line, e.name)
+		}
+	}
+
+	f, err := os.Open(*regionMap)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *regionMap, err)
+	}
+	if img.Bounds() != frameBounds {
+		return fmt.Errorf("%s is %v, but the rendered frames are %v", *regionMap, img.Bounds(), frameBounds)
+	}
+
+	m, ok := img.(*image.NRGBA)
+	if !ok {
+		m = image.NewNRGBA(img.Bounds())
+		draw.Draw(m, m.Rect, img, img.Bounds().Min, draw.Src)
+	}
+
+	found := make(map[uint32]image.Rectangle, len(entries))
+	for _, e := range entries {
+		found[e.color] = image.Rectangle{}
+	}
+
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			o := m.PixOffset(x, y)
+			// ignore anything that isn't fully opaque, such as antialiased edges against a transparent background
+			if m.Pix[o+3] != 255 {
+				continue
+			}
+
+			c := uint32(m.Pix[o+0])<<16 | uint32(m.Pix[o+1])<<8 | uint32(m.Pix[o+2])
+			if r, ok := found[c]; ok {
+				found[c] = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	rects := make(map[string]image.Rectangle, len(entries))
+	for _, e := range entries {
+		r := found[e.color]
+		if r.Empty() {
+			fmt.Printf("warning: %s:%d: color %06x (%s) does not appear in %s\n", *regionNames, e.line, e.color, e.name, *regionMap)
+			continue
+		}
+
+		rects[e.name] = r.Inset(-*regionMargin).Intersect(frameBounds)
+	}
+
+	for sheetIndex := 0; sheetIndex < len(sheets)+len(additiveSheets); sheetIndex++ {
+		ids, areaRects := layoutRects(sheetIndex)
+		for i, id := range ids {
+			if r, ok := rects[id]; ok {
+				*areaRects[i] = r
+			}
+		}
+	}
+
+	names := make([]string, 0, len(rects))
+	for name := range rects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if rects[a].Overlaps(rects[b]) {
+				fmt.Printf("warning: region map areas %s %v and %s %v overlap\n", a, rects[a], b, rects[b])
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type previewServer struct {
+	onlyFrame int
+
+	mu         sync.Mutex
+	stamp      string
+	generation int
+	built      []*builtSheet
+	cache      map[string][]byte
+}
+
+type previewArea struct {
+	ID   string `json:"id"`
+	MinX int    `json:"x0"`
+	MinY int    `json:"y0"`
+	MaxX int    `json:"x1"`
+	MaxY int    `json:"y1"`
+}
+
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	onlyName := fs.String("frame", "", "only show the sequences cropped from this render frame (name or number); by default every base sequence is shown")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	onlyFrame, err := parseFrameFilter(*onlyName)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &previewServer{onlyFrame: onlyFrame}
+	if _, err := s.refresh(); err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveIndex)
+	mux.HandleFunc("/version", s.serveVersion)
+	mux.HandleFunc("/areas.json", s.serveAreas)
+	mux.HandleFunc("/menu.png", s.serveMenu)
+
+	fmt.Printf("serving preview on http://%s/\n", *addr)
+	panic(http.ListenAndServe(*addr, mux))
+}
+
+// refresh reloads the built sheets if any of their files have changed since
+// the last call, and returns a string that changes whenever they do.
+func (s *previewServer) refresh() (string, error) {
+	var stamp strings.Builder
+	for i := 0; i < len(sheets)+len(additiveSheets); i++ {
+		name, _ := sheetNames(i)
+		for _, ext := range [...]string{".tga", ".sht"} {
+			fi, err := os.Stat(outputPath(name + ext))
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(&stamp, "%x-%x.", fi.ModTime().UnixNano(), fi.Size())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stamp.String() == s.stamp {
+		return s.stamp, nil
+	}
+
+	built, err := loadBuiltSheets()
+	if err != nil {
+		// probably caught the build in the middle of writing files; keep showing the old version
+		if s.built != nil {
+			log.Printf("keeping previous sheets: %v", err)
+			return s.stamp, nil
+		}
+
+		return "", err
+	}
+
+	log.Println("loaded sheets")
+
+	s.stamp = stamp.String()
+	s.generation++
+	s.built = built
+	s.cache = make(map[string][]byte)
+
+	return s.stamp, nil
+}
+
+func (s *previewServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, previewPage, frameBounds.Dx(), frameBounds.Dy())
+}
+
+func (s *previewServer) serveVersion(w http.ResponseWriter, r *http.Request) {
+	stamp, err := s.refresh()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, stamp)
+}
+
+func (s *previewServer) serveAreas(w http.ResponseWriter, r *http.Request) {
+	var areas []previewArea
+	for i := range additiveSheets {
+		g := buildHoverGraph(&additiveSheets[i])
+		for _, target := range g.targets() {
+			rect := g.sheet.areas[target].rect
+			areas = append(areas, previewArea{
+				ID:   g.ids[target],
+				MinX: rect.Min.X,
+				MinY: rect.Min.Y,
+				MaxX: rect.Max.X,
+				MaxY: rect.Max.Y,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(areas)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (s *previewServer) serveMenu(w http.ResponseWriter, r *http.Request) {
+	hover := r.URL.Query().Get("hover")
+
+	s.mu.Lock()
+	b, ok := s.cache[hover]
+	built, generation := s.built, s.generation
+	s.mu.Unlock()
+
+	if !ok {
+		img, err := renderPreview(built, s.onlyFrame, hover)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		var buf bytes.Buffer
+		e := png.Encoder{CompressionLevel: png.BestSpeed}
+		err = e.Encode(&buf, img)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b = buf.Bytes()
+
+		s.mu.Lock()
+		// don't cache an image rendered from sheets that have since been replaced
+		if s.generation == generation {
+			s.cache[hover] = b
+		}
+		s.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(b)
+}
+
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>main menu preview</title>
+<style>
+html, body { margin: 0; background: #222; color: #ccc; font: 14px sans-serif; }
+#menu { display: block; width: 100%%; height: auto; }
+#status { position: fixed; bottom: 0; left: 0; padding: 4px 8px; background: rgba(0, 0, 0, 0.6); }
+</style>
+</head>
+<body>
+<img id="menu" src="/menu.png" width="%d" height="%d" alt="">
+<div id="status"></div>
+<script>
+var menu = document.getElementById("menu");
+var statusLine = document.getElementById("status");
+var areas = [];
+var hover = "";
+var version = "";
+
+function update() {
+	menu.src = "/menu.png?hover=" + encodeURIComponent(hover) + "&v=" + encodeURIComponent(version);
+	statusLine.textContent = hover || "(nothing hovered)";
+}
+
+menu.addEventListener("mousemove", function(e) {
+	var rect = menu.getBoundingClientRect();
+	var x = (e.clientX - rect.left) * menu.naturalWidth / rect.width;
+	var y = (e.clientY - rect.top) * menu.naturalHeight / rect.height;
+	var found = "";
+	for (var i = 0; i < areas.length; i++) {
+		var a = areas[i];
+		if (x >= a.x0 && x < a.x1 && y >= a.y0 && y < a.y1) {
+			found = a.id;
+			break;
+		}
+	}
+	if (found !== hover) {
+		hover = found;
+		update();
+	}
+});
+
+menu.addEventListener("mouseleave", function() {
+	if (hover !== "") {
+		hover = "";
+		update();
+	}
+});
+
+fetch("/areas.json").then(function(r) { return r.json(); }).then(function(a) { areas = a || []; });
+
+// reload whenever the sheets are rebuilt
+setInterval(function() {
+	fetch("/version").then(function(r) { return r.ok ? r.text() : version; }).then(function(v) {
+		if (v !== version) {
+			var first = version === "";
+			version = v;
+			if (!first) {
+				update();
+			}
+		}
+	});
+}, 1000);
+
+update();
+</script>
+</body>
+</html>
+`
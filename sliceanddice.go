@@ -2,23 +2,28 @@ package main
 
 import (
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
+	"io/fs"
 	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/ftrvxmtrx/tga"
 )
 
 type sheet struct {
-	name  string
-	enum  string
-	areas []area
+	name   string
+	enum   string
+	areas  []area
+	groups []areaGroup
 }
 
 type area struct {
@@ -28,14 +33,15 @@ type area struct {
 }
 
 type frame struct {
-	index  int
+	render string
 	suffix string
 }
 
 type additiveSheet struct {
-	name  string
-	enum  string
-	areas []additiveArea
+	name   string
+	enum   string
+	areas  []additiveArea
+	groups []additiveAreaGroup
 }
 
 type additiveArea struct {
@@ -45,24 +51,48 @@ type additiveArea struct {
 }
 
 type additiveFrame struct {
-	base   int
-	index  int
+	base   string
+	render string
 	suffix string
 }
 
 type sequence struct {
 	name string
 	img  *image.NRGBA
-	img2 *image.NRGBA
+	// the un-quantized crops img is made from: the base sheet or hover crop,
+	// and an additive sequence's base crop
+	crop, crop2 *floatImage
+
+	frames []int
+	// the hover frame is a glow pass rather than a full render
+	glow bool
+	// the additive area instance the sequence was cropped from, and where
+	area string
+	rect image.Rectangle
+	// see buildCache.maskKey
+	maskKey string
+	// for sequences drawn by generateHover instead of cropped from a hover frame
+	generated glowStyle
+
+	inputKey string
+	cached   bool
 }
 
 type queuedFrame struct {
 	name  string
+	area  string
 	index int
+	glow  bool
 	rect  image.Rectangle
-	img   **image.NRGBA
+	crop  **floatImage
+	seq   *sequence
+	// see sequence.generated
+	generated glowStyle
 }
 
+// the size of the rendered frames (and the design-space coordinates of the menu)
+var frameBounds = image.Rect(0, 0, 5120, 3840)
+
 var sheets = [...]sheet{
 	{
 		"main_menu_sheet",
@@ -72,230 +102,184 @@ var sheets = [...]sheet{
 				"settings",
 				image.Rect(0, 0, 192, 192),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"notifications",
 				image.Rect(4640, 0, 4832, 192),
 				[]frame{
-					{0, ""},
-					{21, "_dull"},
+					{"base", ""},
+					{"workshop_hover", "_dull"},
 				},
 			},
 			{
 				"quit",
 				image.Rect(4928, 0, 5120, 192),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"logo",
 				image.Rect(384, 0, 896, 256),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
-			{
-				"top_button",
-				image.Rect(1216, 0, 1728, 208),
-				[]frame{},
-			},
-			{
-				"top_button",
-				image.Rect(1760, 0, 2272, 208),
-				[]frame{},
-			},
-			{
-				"top_button",
-				image.Rect(2304, 0, 2816, 208),
-				[]frame{
-					{0, ""},
-				},
-			},
-			{
-				"top_button",
-				image.Rect(2848, 0, 3360, 208),
-				[]frame{},
-			},
-			{
-				"top_button",
-				image.Rect(3392, 0, 3904, 208),
-				[]frame{},
-			},
 			{
 				"profile",
 				image.Rect(80, 320, 1240, 896),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"create_lobby",
 				image.Rect(80, 1000, 1240, 1240),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"singleplayer",
 				image.Rect(80, 1280, 1120, 1480),
 				[]frame{
-					{0, ""},
-				},
-			},
-			{
-				"quick_join",
-				image.Rect(80, 1520, 1120, 2240),
-				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
-			{
-				"quick_join",
-				image.Rect(80, 2280, 1120, 3000),
-				[]frame{},
-			},
 			{
 				"workshop",
 				image.Rect(80, 3040, 1120, 3632),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"hoiaf_top_1",
 				image.Rect(3440, 320, 5040, 480),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 480, 5040, 600),
-				[]frame{
-					{0, ""},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 600, 5040, 720),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 720, 5040, 840),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 840, 5040, 960),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 960, 5040, 1080),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1080, 5040, 1200),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1200, 5040, 1320),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1320, 5040, 1440),
-				[]frame{},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1440, 5040, 1560),
-				[]frame{},
-			},
 			{
 				"hoiaf_timer",
 				image.Rect(3440, 1600, 5040, 1760),
 				[]frame{
-					{0, ""},
-				},
-			},
-			{
-				"event_timer",
-				image.Rect(3440, 1832, 5040, 2032),
-				[]frame{},
-			},
-			{
-				"event_timer",
-				image.Rect(3440, 2032, 5040, 2232),
-				[]frame{},
-			},
-			{
-				"event_timer",
-				image.Rect(3440, 2232, 5040, 2432),
-				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"news",
 				image.Rect(3440, 2472, 5040, 3392),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"update",
 				image.Rect(3440, 3432, 5040, 3632),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"ticker_left",
 				image.Rect(0, 3680, 1200, 3840),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"ticker_right",
 				image.Rect(3320, 3680, 5120, 3840),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"ticker_mid",
 				image.Rect(2480, 3680, 2640, 3840),
 				[]frame{
-					{0, ""},
+					{"base", ""},
 				},
 			},
 			{
 				"top_bar",
 				image.Rect(2048, 0, 3072, 192),
 				[]frame{
-					{22, ""},
+					{"top_bar", ""},
 				},
 			},
 			{
 				"top_bar_left",
 				image.Rect(0, 0, 1920, 192),
 				[]frame{
-					{22, ""},
+					{"top_bar", ""},
 				},
 			},
 			{
 				"top_bar_right",
 				image.Rect(3200, 0, 5120, 192),
 				[]frame{
-					{22, ""},
+					{"top_bar", ""},
+				},
+			},
+		},
+		[]areaGroup{
+			{
+				"top_button",
+				[]image.Rectangle{
+					image.Rect(1216, 0, 1728, 208),
+					image.Rect(1760, 0, 2272, 208),
+					image.Rect(2304, 0, 2816, 208),
+					image.Rect(2848, 0, 3360, 208),
+					image.Rect(3392, 0, 3904, 208),
+				},
+				3,
+				[]frame{
+					{"base", ""},
+				},
+			},
+			{
+				"quick_join",
+				[]image.Rectangle{
+					image.Rect(80, 1520, 1120, 2240),
+					image.Rect(80, 2280, 1120, 3000),
+				},
+				1,
+				[]frame{
+					{"base", ""},
+				},
+			},
+			{
+				"hoiaf_top_10",
+				[]image.Rectangle{
+					image.Rect(3520, 480, 5040, 600),
+					image.Rect(3520, 600, 5040, 720),
+					image.Rect(3520, 720, 5040, 840),
+					image.Rect(3520, 840, 5040, 960),
+					image.Rect(3520, 960, 5040, 1080),
+					image.Rect(3520, 1080, 5040, 1200),
+					image.Rect(3520, 1200, 5040, 1320),
+					image.Rect(3520, 1320, 5040, 1440),
+					image.Rect(3520, 1440, 5040, 1560),
+				},
+				1,
+				[]frame{
+					{"base", ""},
+				},
+			},
+			{
+				"event_timer",
+				[]image.Rectangle{
+					image.Rect(3440, 1832, 5040, 2032),
+					image.Rect(3440, 2032, 5040, 2232),
+					image.Rect(3440, 2232, 5040, 2432),
+				},
+				3,
+				[]frame{
+					{"base", ""},
 				},
 			},
 		},
@@ -311,258 +295,120 @@ var additiveSheets = []additiveSheet{
 				"settings",
 				image.Rect(0, 0, 192, 192),
 				[]additiveFrame{
-					{0, 1, "_logo_hover"},
-					{0, 2, "_hover"},
-					{0, 4, "_profile_hover"},
+					{"base", "logo_hover", "_logo_hover"},
+					{"base", "settings_hover", "_hover"},
+					{"base", "profile_hover", "_profile_hover"},
 				},
 			},
 			{
 				"notifications",
 				image.Rect(4640, 0, 4832, 192),
 				[]additiveFrame{
-					{0, 2, "_hover"},
-					{0, 3, "_quit_hover"},
+					{"base", "settings_hover", "_hover"},
+					{"base", "quit_hover", "_quit_hover"},
 				},
 			},
 			{
 				"quit",
 				image.Rect(4928, 0, 5120, 192),
 				[]additiveFrame{
-					{0, 2, "_notifications_hover"},
-					{0, 3, "_hover"},
+					{"base", "settings_hover", "_notifications_hover"},
+					{"base", "quit_hover", "_hover"},
 				},
 			},
 			{
 				"logo",
 				image.Rect(384, 0, 896, 256),
 				[]additiveFrame{
-					{0, 1, "_hover"},
-					{0, 2, "_settings_hover"},
-					{0, 4, "_profile_hover"},
-				},
-			},
-			{
-				"top_button",
-				image.Rect(1216, 0, 1728, 208),
-				[]additiveFrame{
-					{0, 4, "_profile_hover"},
-				},
-			},
-			{
-				"top_button",
-				image.Rect(1760, 0, 2272, 208),
-				[]additiveFrame{
-					{0, 20, "_right_hover"},
-				},
-			},
-			{
-				"top_button",
-				image.Rect(2304, 0, 2816, 208),
-				[]additiveFrame{
-					{0, 20, "_hover"},
-				},
-			},
-			{
-				"top_button",
-				image.Rect(2848, 0, 3360, 208),
-				[]additiveFrame{
-					{0, 20, "_left_hover"},
+					{"base", "logo_hover", "_hover"},
+					{"base", "settings_hover", "_settings_hover"},
+					{"base", "profile_hover", "_profile_hover"},
 				},
 			},
-			{
-				"top_button",
-				image.Rect(3392, 0, 3904, 208),
-				[]additiveFrame{},
-			},
 			{
 				"profile",
 				image.Rect(80, 320, 1240, 896),
 				[]additiveFrame{
-					{0, 1, "_logo_hover"},
-					{0, 2, "_settings_hover"},
-					{0, 4, "_hover"},
-					{0, 5, "_create_lobby_hover"},
+					{"base", "logo_hover", "_logo_hover"},
+					{"base", "settings_hover", "_settings_hover"},
+					{"base", "profile_hover", "_hover"},
+					{"base", "create_lobby_hover", "_create_lobby_hover"},
 				},
 			},
 			{
 				"create_lobby",
 				image.Rect(80, 1000, 1240, 1240),
 				[]additiveFrame{
-					{0, 1, "_logo_hover"},
-					{0, 4, "_profile_hover"},
-					{0, 5, "_hover"},
-					{0, 19, "_singleplayer_hover"},
+					{"base", "logo_hover", "_logo_hover"},
+					{"base", "profile_hover", "_profile_hover"},
+					{"base", "create_lobby_hover", "_hover"},
+					{"base", "singleplayer_hover", "_singleplayer_hover"},
 				},
 			},
 			{
 				"singleplayer",
 				image.Rect(80, 1280, 1120, 1480),
 				[]additiveFrame{
-					{0, 5, "_create_lobby_hover"},
-					{0, 18, "_quick_join_hover"},
-					{0, 19, "_hover"},
-				},
-			},
-			{
-				"quick_join",
-				image.Rect(80, 1520, 1120, 2240),
-				[]additiveFrame{
-					{0, 9, "_below_hover"},
-					{0, 19, "_singleplayer_hover"},
-				},
-			},
-			{
-				"quick_join",
-				image.Rect(80, 2280, 1120, 3000),
-				[]additiveFrame{
-					{0, 9, "_hover"},
-					{0, 18, "_above_hover"},
+					{"base", "create_lobby_hover", "_create_lobby_hover"},
+					{"base", "quick_join_1_hover", "_quick_join_hover"},
+					{"base", "singleplayer_hover", "_hover"},
 				},
 			},
 			{
 				"workshop",
 				image.Rect(80, 3040, 1120, 3632),
 				[]additiveFrame{
-					{0, 9, "_quick_join_hover"},
-					{0, 21, "_hover"},
+					{"base", "quick_join_2_hover", "_quick_join_hover"},
+					{"base", "workshop_hover", "_hover"},
 				},
 			},
 			{
 				"hoiaf_top_1",
 				image.Rect(3440, 320, 5040, 480),
 				[]additiveFrame{
-					{0, 3, "_quit_hover"},
-					{0, 11, "_hover"},
-					{0, 12, "_below_hover"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 480, 5040, 600),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_1"},
-					{0, 13, "_below_hover"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 600, 5040, 720),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_2"},
-					{0, 13, "_hover"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 720, 5040, 840),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_3"},
-					{0, 13, "_above_hover"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 840, 5040, 960),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_4"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 960, 5040, 1080),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_5"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1080, 5040, 1200),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_6"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1200, 5040, 1320),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_7"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1320, 5040, 1440),
-				[]additiveFrame{
-					{0, 3, "_quit_hover_8"},
-				},
-			},
-			{
-				"hoiaf_top_10",
-				image.Rect(3520, 1440, 5040, 1560),
-				[]additiveFrame{
-					{0, 10, "_hoiaf_timer_hover"},
+					{"base", "quit_hover", "_quit_hover"},
+					{"base", "hoiaf_top_1_hover", "_hover"},
+					{"base", "hoiaf_top_10_1_hover", "_below_hover"},
 				},
 			},
 			{
 				"hoiaf_timer",
 				image.Rect(3440, 1600, 5040, 1760),
 				[]additiveFrame{
-					{0, 8, "_event_timer_hover"},
-					{0, 10, "_hover"},
-					{0, 15, "_hoiaf_top_10_hover"},
-				},
-			},
-			{
-				"event_timer",
-				image.Rect(3440, 1832, 5040, 2032),
-				[]additiveFrame{
-					{0, 10, "_hoiaf_timer_hover"},
-				},
-			},
-			{
-				"event_timer",
-				image.Rect(3440, 2032, 5040, 2232),
-				[]additiveFrame{
-					{0, 6, "_below_hover"},
-				},
-			},
-			{
-				"event_timer",
-				image.Rect(3440, 2232, 5040, 2432),
-				[]additiveFrame{
-					{0, 6, "_hover"},
-					{0, 7, "_above_hover"},
-					{0, 17, "_news_hover"},
+					{"base", "event_timer_1_hover", "_event_timer_hover"},
+					{"base", "hoiaf_timer_hover", "_hover"},
+					{"base", "hoiaf_top_10_9_hover", "_hoiaf_top_10_hover"},
 				},
 			},
 			{
 				"news",
 				image.Rect(3440, 2472, 5040, 3392),
 				[]additiveFrame{
-					{0, 6, "_event_timer_hover"},
-					{0, 16, "_update_hover"},
-					{0, 17, "_hover"},
+					{"base", "event_timer_3_hover", "_event_timer_hover"},
+					{"base", "update_hover", "_update_hover"},
+					{"base", "news_hover", "_hover"},
 				},
 			},
 			{
 				"update",
 				image.Rect(3440, 3432, 5040, 3632),
 				[]additiveFrame{
-					{0, 16, "_hover"},
-					{0, 17, "_news_hover"},
+					{"base", "update_hover", "_hover"},
+					{"base", "news_hover", "_news_hover"},
 				},
 			},
 			{
 				"ticker_left",
 				image.Rect(0, 3680, 1200, 3840),
 				[]additiveFrame{
-					{0, 21, "_workshop_hover"},
+					{"base", "workshop_hover", "_workshop_hover"},
 				},
 			},
 			{
 				"ticker_right",
 				image.Rect(3320, 3680, 5120, 3840),
 				[]additiveFrame{
-					{0, 16, "_update_hover"},
+					{"base", "update_hover", "_update_hover"},
 				},
 			},
 			{
@@ -574,31 +420,124 @@ var additiveSheets = []additiveSheet{
 				"top_bar",
 				image.Rect(2048, 0, 3072, 192),
 				[]additiveFrame{
-					{22, 25, "_button_glow"},
+					{"top_bar", "top_bar_profile_glow", "_button_glow"},
 				},
 			},
 			{
 				"top_bar_left",
 				image.Rect(0, 0, 1920, 192),
 				[]additiveFrame{
-					{22, 23, "_settings_glow"},
-					{22, 24, "_logo_glow"},
-					{22, 25, "_profile_glow"},
+					{"top_bar", "top_bar_settings_glow", "_settings_glow"},
+					{"top_bar", "top_bar_logo_glow", "_logo_glow"},
+					{"top_bar", "top_bar_profile_glow", "_profile_glow"},
 				},
 			},
 			{
 				"top_bar_right",
 				image.Rect(3200, 0, 5120, 192),
 				[]additiveFrame{
-					{22, 23, "_notifications_glow"},
-					{22, 24, "_quit_glow"},
-					{22, 25, "_hoiaf_glow"},
+					{"top_bar", "top_bar_settings_glow", "_notifications_glow"},
+					{"top_bar", "top_bar_logo_glow", "_quit_glow"},
+					{"top_bar", "top_bar_profile_glow", "_hoiaf_glow"},
+				},
+			},
+		},
+		[]additiveAreaGroup{
+			{
+				"top_button",
+				[]image.Rectangle{
+					image.Rect(1216, 0, 1728, 208),
+					image.Rect(1760, 0, 2272, 208),
+					image.Rect(2304, 0, 2816, 208),
+					image.Rect(2848, 0, 3360, 208),
+					image.Rect(3392, 0, 3904, 208),
+				},
+				map[int][]additiveFrame{
+					1: {{"base", "profile_hover", "_profile_hover"}},
+					2: {{"base", "top_button_3_hover", "_right_hover"}},
+					3: {{"base", "top_button_3_hover", "_hover"}},
+					4: {{"base", "top_button_3_hover", "_left_hover"}},
+				},
+				nil,
+			},
+			{
+				"quick_join",
+				[]image.Rectangle{
+					image.Rect(80, 1520, 1120, 2240),
+					image.Rect(80, 2280, 1120, 3000),
+				},
+				map[int][]additiveFrame{
+					1: {
+						{"base", "quick_join_2_hover", "_below_hover"},
+						{"base", "singleplayer_hover", "_singleplayer_hover"},
+					},
+					2: {
+						{"base", "quick_join_2_hover", "_hover"},
+						{"base", "quick_join_1_hover", "_above_hover"},
+					},
+				},
+				nil,
+			},
+			{
+				"hoiaf_top_10",
+				[]image.Rectangle{
+					image.Rect(3520, 480, 5040, 600),
+					image.Rect(3520, 600, 5040, 720),
+					image.Rect(3520, 720, 5040, 840),
+					image.Rect(3520, 840, 5040, 960),
+					image.Rect(3520, 960, 5040, 1080),
+					image.Rect(3520, 1080, 5040, 1200),
+					image.Rect(3520, 1200, 5040, 1320),
+					image.Rect(3520, 1320, 5040, 1440),
+					image.Rect(3520, 1440, 5040, 1560),
+				},
+				map[int][]additiveFrame{
+					1: {{"base", "hoiaf_top_10_2_hover", "_below_hover"}},
+					2: {{"base", "hoiaf_top_10_2_hover", "_hover"}},
+					3: {{"base", "hoiaf_top_10_2_hover", "_above_hover"}},
+					9: {{"base", "hoiaf_timer_hover", "_hoiaf_timer_hover"}},
+				},
+				[]indexedFrame{
+					{memberRange(1, 8), additiveFrame{"base", "quit_hover", "_quit_hover"}},
 				},
 			},
+			{
+				"event_timer",
+				[]image.Rectangle{
+					image.Rect(3440, 1832, 5040, 2032),
+					image.Rect(3440, 2032, 5040, 2232),
+					image.Rect(3440, 2232, 5040, 2432),
+				},
+				map[int][]additiveFrame{
+					1: {{"base", "hoiaf_timer_hover", "_hoiaf_timer_hover"}},
+					2: {{"base", "event_timer_3_hover", "_below_hover"}},
+					3: {
+						{"base", "event_timer_3_hover", "_hover"},
+						{"base", "event_timer_2_hover", "_above_hover"},
+						{"base", "news_hover", "_news_hover"},
+					},
+				},
+				nil,
+			},
 		},
 	},
 }
 
+// polygons, in frame coordinates, that confine the additive overlays of an area
+// instance (such as hoiaf_top_10_3) to the pixels inside them, for hovers that
+// also light up part of a neighboring element; see also -mask-dir
+var additiveMasks = map[string][]image.Point{}
+
+// hover overlays drawn from the alpha of an area instance's base frame instead
+// of cropped from a hover frame, for mockups and for areas without a hover render
+var generatedHovers = map[string][]generatedFrame{
+	// an orange glow around the settings button, as settings_outer_glow:
+	//
+	// "settings": {
+	// 	{"base", "_outer_glow", glowStyle{glowOuter, 8, 1, []color.NRGBA{{255, 128, 0, 255}}}},
+	// },
+}
+
 // prevent new sequences from completely ruining modded versions of the main menu
 // they'll still look bad for the new areas but at least the old areas won't move
 var sequenceAddedInUpdate = map[string]int{
@@ -610,7 +549,87 @@ var sequenceAddedInUpdate = map[string]int{
 	"top_bar_right_notifications_glow": 1,
 }
 
+var (
+	dither            ditherMethod
+	tonemap           tonemapMethod
+	denoise           denoiseMethod
+	inputDir          = flag.String("input-dir", ".", "directory or .zip, .tar, or .tar.gz archive containing the rendered frames")
+	inputPattern      = flag.String("pattern", "mainmenu_%04d.png", "file name of the rendered frames; either a printf-style pattern (mainmenu_%04d.png) or a Blender-style pattern (mainmenu_####.png)")
+	glowPattern       = flag.String("glow-pattern", "", "file name of the glow passes, in the same format as -pattern (mainmenu_glow_%04d.png); hover frames that have one use it as the additive sequence instead of subtracting the base frame")
+	exrLayer          = flag.String("exr-layer", "", "channel prefix to read from OpenEXR frames, such as ViewLayer.Combined for a multilayer file (default the plain R, G, B, and A channels)")
+	glowLayer         = flag.String("glow-layer", "", "channel prefix to read from OpenEXR glow passes, such as ViewLayer.Emit; with multilayer files, -glow-pattern can be the same as -pattern")
+	exposure          = flag.Float64("exposure", 0, "exposure adjustment, in stops, applied to OpenEXR frames before tonemapping")
+	startFrame        = flag.Int("start-frame", 0, "number of the file containing render frame 0")
+	outputDir         = flag.String("output-dir", ".", "directory to write the generated files to")
+	templateTolerance = flag.Int("template-tolerance", 0, "largest difference in any channel allowed between the members of an area group before a warning is printed")
+	noiseFloor        = flag.Float64("noise-floor", 0, "differences between the base and hover frames at most this large (out of 255) are treated as render noise and dropped")
+	denoiseRadius     = flag.Int("denoise-radius", 1, "radius, in pixels, of the -denoise filter")
+	denoiseRange      = flag.Float64("denoise-range", 16, "how different (out of 255) two pixels can be before the bilateral filter stops blending them")
+	maskDir           = flag.String("mask-dir", "", "directory of PNG masks for additive areas, named after the area's instance ID (such as quick_join_2.png); the difference is kept under white pixels and dropped under black or transparent ones")
+	sampleDirs        = flag.String("sample-dirs", "", "comma-separated directories or archives with more renders of the same frames, using different seeds; each frame is averaged with the copies that exist")
+	noCache           = flag.Bool("no-cache", false, "rebuild everything instead of re-using unchanged sheets and sequences from the previous build")
+	frameMarkers      = flag.String("frame-markers", "", "Blender file whose timeline markers name the render frames, instead of the frames table")
+	blendLayout       = flag.String("blend-layout", "", "Blender file to read the rectangles of the areas listed in the blend command's table from")
+	regionMap         = flag.String("region-map", "", "PNG image rendered from the same camera where each area is a flat, unique color; replaces the rectangles of the areas listed in -region-names")
+	regionNames       = flag.String("region-names", "", "text file with one \"rrggbb area\" line per color in the region map, where area is an instance ID such as hoiaf_top_10_3")
+	regionMargin      = flag.Int("region-margin", 0, "number of pixels to add around each area found in the region map")
+	vmtDir            = flag.String("vmt-dir", "", "directory to write the generated .vmt files to (default the output directory)")
+	materialPath      = flag.String("material-path", "vgui", "path of the sheet textures relative to the game's materials directory")
+)
+
+func init() {
+	flag.Var(&dither, "dither", "dithering to apply when quantizing additive sequences to 8 bits (none, ordered, or floyd-steinberg)")
+	flag.Var(&denoise, "denoise", "filter to apply to the difference between the base and hover frames (none, median, or bilateral)")
+	flag.Var(&tonemap, "tonemap", "how to fit the brightness of OpenEXR frames into 8 bits (clamp, reinhard, or aces)")
+}
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [command [command flags]]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "commands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  build    crop, pack, and compile the sheets (default)\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  watch    rebuild the sheets whenever the rendered frames change\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  plan     list the frames and sequences a build would use, without reading any images\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  preview  render the built sheets back into a menu screenshot\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  serve    start a local web server for previewing the built sheets\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  lint     check the layout and the hover relationships in the additive sheets\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  blend    compare the area rectangles to the objects in mainmenu.blend\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  package  put the built sheets in a VPK file\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	err := loadLayout()
+	if err != nil {
+		panic(err)
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "", "build":
+		build()
+	case "watch":
+		watch(flag.Args()[1:])
+	case "plan":
+		planCommand(flag.Args()[1:])
+	case "blend":
+		blendCommand(flag.Args()[1:])
+	case "preview":
+		preview(flag.Args()[1:])
+	case "serve":
+		serve(flag.Args()[1:])
+	case "lint":
+		lint(flag.Args()[1:])
+	case "package":
+		packageCommand(flag.Args()[1:])
+	default:
+		fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func requestFrames() [][]queuedFrame {
 	requested := make([][]queuedFrame, len(sheets)+len(additiveSheets))
 
 	for i, s := range sheets {
@@ -619,108 +638,302 @@ func main() {
 				requested[i] = append(requested[i], queuedFrame{
 					name:  a.name + f.suffix,
 					rect:  a.rect,
-					index: f.index,
+					index: frameNumber(f.render),
 				})
 			}
 		}
 	}
 	for i, s := range additiveSheets {
-		for _, a := range s.areas {
+		ids := areaInstanceIDs(s.areas)
+		for j, a := range s.areas {
 			for _, f := range a.frames {
+				style, generated := generatedStyle(len(sheets)+i, a.name+f.suffix)
 				requested[len(sheets)+i] = append(requested[len(sheets)+i], queuedFrame{
 					name:  a.name + f.suffix,
+					area:  ids[j],
 					rect:  a.rect,
-					index: f.base,
+					index: frameNumber(f.base),
 				}, queuedFrame{
 					name:  a.name + f.suffix,
+					area:  ids[j],
 					rect:  a.rect,
-					index: f.index,
+					index: frameNumber(f.render),
+					glow:  !generated && hasGlowPass(frameNumber(f.render)),
+
+					generated: style,
 				})
 			}
 		}
 	}
 
+	return requested
+}
+
+// sheetSequenceNames returns the names of the sequences in a sheet, in the order they are written to the .sht file.
+func sheetSequenceNames(sheetIndex int) []string {
+	var names []string
+	for i, q := range requestFrames()[sheetIndex] {
+		// additive sequences are requested twice (base frame and hover frame)
+		if sheetIndex >= len(sheets) && i%2 == 1 {
+			continue
+		}
+
+		names = append(names, q.name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return sequenceLess(names[i], names[j])
+	})
+
+	return names
+}
+
+func sequenceLess(a, b string) bool {
+	aa := sequenceAddedInUpdate[a]
+	bb := sequenceAddedInUpdate[b]
+	if aa != bb {
+		return aa < bb
+	}
+
+	return a < b
+}
+
+func sheetNames(sheetIndex int) (name, enumName string) {
+	if sheetIndex < len(sheets) {
+		return sheets[sheetIndex].name, sheets[sheetIndex].enum
+	}
+
+	return additiveSheets[sheetIndex-len(sheets)].name, additiveSheets[sheetIndex-len(sheets)].enum
+}
+
+func build() {
+	buildSheets(nil)
+}
+
+// buildSheets builds the sheets whose indices are true in selected, or every
+// sheet if selected is nil.
+func buildSheets(selected []bool) {
+	if problems := validateLayout(selected, true); len(problems) != 0 {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+
+		panic(fmt.Sprintf("%d problems found in the layout", len(problems)))
+	}
+
+	requested := requestFrames()
+
 	sheetSequences := make([][]sequence, len(sheets)+len(additiveSheets))
 	for i, r := range requested {
 		if i >= len(sheets) {
 			sheetSequences[i] = make([]sequence, len(r)/2)
 			for j := 0; j < len(r); j += 2 {
 				sheetSequences[i][j/2].name = r[j].name
-				r[j].img = &sheetSequences[i][j/2].img2
-				r[j+1].img = &sheetSequences[i][j/2].img
+				r[j].crop = &sheetSequences[i][j/2].crop2
+				r[j+1].crop = &sheetSequences[i][j/2].crop
+				r[j].seq = &sheetSequences[i][j/2]
+				r[j+1].seq = &sheetSequences[i][j/2]
+				sheetSequences[i][j/2].frames = []int{r[j].index, r[j+1].index}
+				sheetSequences[i][j/2].glow = r[j+1].glow
+				sheetSequences[i][j/2].area = r[j].area
+				sheetSequences[i][j/2].rect = r[j].rect
+				sheetSequences[i][j/2].generated = r[j+1].generated
 			}
 		} else {
 			sheetSequences[i] = make([]sequence, len(r))
 			for j := range r {
 				sheetSequences[i][j].name = r[j].name
-				r[j].img = &sheetSequences[i][j].img
+				r[j].crop = &sheetSequences[i][j].crop
+				r[j].seq = &sheetSequences[i][j]
+				sheetSequences[i][j].frames = []int{r[j].index}
 			}
 		}
 	}
 
-	for i := 0; ; i++ {
-		src, err := readFrame(i)
+	cache := loadBuildCache()
+
+	// skip sheets whose inputs have not changed since the last build
+	skip := make([]bool, len(sheetSequences))
+	sheetKeys := make([]string, len(sheetSequences))
+	for i := range sheetSequences {
+		if selected != nil && !selected[i] {
+			skip[i] = true
+			continue
+		}
+		if cache.disabled {
+			continue
+		}
+
+		key, err := cache.sheetInputKey(i, requested[i])
 		if err != nil {
-			if os.IsNotExist(err) {
-				break
+			panic(err)
+		}
+
+		sheetKeys[i] = key
+		if cache.sheetFresh(i, func(e sheetCacheEntry) string { return e.InputKey }, key) {
+			name, _ := sheetNames(i)
+			fmt.Printf("%s is up to date\n", name)
+			skip[i] = true
+		}
+	}
+
+	// re-use sequences whose inputs have not changed
+	for i := range sheetSequences {
+		if skip[i] || cache.disabled {
+			continue
+		}
+
+		for j := range sheetSequences[i] {
+			s := &sheetSequences[i][j]
+
+			var err error
+			if s.area != "" {
+				s.maskKey, err = cache.maskKey(s.area)
+				if err != nil {
+					panic(err)
+				}
 			}
 
+			s.inputKey, err = cache.sequenceInputKey(i, s.name, s.frames, s.glow, s.maskKey)
+			if err != nil {
+				panic(err)
+			}
+
+			if img := cache.loadSequence(i, s.name, func(e seqCacheEntry) bool { return e.InputKey == s.inputKey }); img != nil {
+				s.img, s.cached = img, true
+			}
+		}
+	}
+
+	neededFrames := make(map[renderFile]bool)
+	for i, r := range requested {
+		for _, q := range r {
+			if !skip[i] && !q.seq.cached {
+				neededFrames[renderFile{q.index, q.glow}] = true
+			}
+		}
+	}
+	frameOrder := make([]renderFile, 0, len(neededFrames))
+	for f := range neededFrames {
+		frameOrder = append(frameOrder, f)
+	}
+	sortRenderFiles(frameOrder)
+
+	for _, rf := range frameOrder {
+		i := rf.index
+		src, err := readFrame(rf)
+		if err != nil {
 			panic(err)
 		}
 
-		for _, r := range requested {
+		for sheetIndex, r := range requested {
 			for _, q := range r {
-				if q.index != i {
+				if q.index != i || q.glow != rf.glow || skip[sheetIndex] || q.seq.cached {
 					continue
 				}
 
 				fmt.Printf("cropping %q\n", q.name)
 
-				sub := src.SubImage(q.rect)
-				rect := sub.Bounds().Sub(sub.Bounds().Min)
-				*q.img = image.NewNRGBA(rect)
-				draw.Draw(*q.img, rect, sub, sub.Bounds().Min, draw.Src)
+				*q.crop = src.crop(q.rect)
 			}
 		}
-	}
 
-	for i := len(sheets); i < len(sheetSequences); i++ {
-		for _, s := range sheetSequences[i] {
-			for y := s.img.Rect.Min.Y; y < s.img.Rect.Max.Y; y++ {
-				for x := s.img.Rect.Min.X; x < s.img.Rect.Max.X; x++ {
-					c0, c1 := s.img.NRGBAAt(x, y), s.img2.NRGBAAt(x, y)
+		for sheetIndex, s := range sheets {
+			if skip[sheetIndex] || rf.glow {
+				continue
+			}
 
-					r := (int(c0.R)*int(c0.A) - int(c1.R)*int(c1.A)) / 255
-					if r < 0 {
-						r = 0
-					}
-					g := (int(c0.G)*int(c0.A) - int(c1.G)*int(c1.A)) / 255
-					if g < 0 {
-						g = 0
-					}
-					b := (int(c0.B)*int(c0.A) - int(c1.B)*int(c1.A)) / 255
-					if b < 0 {
-						b = 0
+			for _, g := range s.groups {
+				for _, f := range g.frames {
+					if frameNumber(f.render) == i {
+						for _, p := range g.templateDifferences(src, i) {
+							fmt.Println("warning:", p)
+						}
+						break
 					}
+				}
+			}
+		}
+	}
 
-					s.img.SetNRGBA(x, y, color.NRGBA{uint8(r), uint8(g), uint8(b), c1.A})
+	for i := range sheetSequences {
+		if skip[i] {
+			continue
+		}
+
+		for j := range sheetSequences[i] {
+			s := &sheetSequences[i][j]
+			if s.cached {
+				continue
+			}
+
+			// the render may have changed without changing this part of it
+			cropHash := sequenceCropKey(s)
+			if img := cache.loadSequence(i, s.name, func(e seqCacheEntry) bool { return e.CropHash == cropHash }); img != nil {
+				s.img = img
+			} else if i < len(sheets) {
+				// the base sheets are drawn as they were rendered, so they're only rounded
+				s.img = quantize(s.crop, ditherNone)
+			} else {
+				mask, err := areaMask(s.area, s.rect)
+				if err != nil {
+					panic(err)
+				}
+
+				if s.generated.kind != glowNone {
+					generateHover(s, mask)
+				} else if subtractBase(s, mask) {
+					name, _ := sheetNames(i)
+					where := "anywhere"
+					if mask != nil {
+						where = "anywhere inside its mask"
+					}
+					fmt.Printf("warning: %s/%s: frame %d (%s) is no brighter than frame %d (%s) %s (above the noise floor of %v); is it using the right frames?\n", name, s.name, s.frames[1], frameNamesOf(s.frames[1]), s.frames[0], frameNamesOf(s.frames[0]), where, *noiseFloor)
 				}
 			}
 
-			s.img2 = nil
+			cache.storeSequence(i, s.name, seqCacheEntry{
+				InputKey: s.inputKey,
+				CropHash: cropHash,
+			}, s.img)
+
+			s.crop, s.crop2 = nil, nil
 		}
 	}
 
 	for sheetIndex, sequences := range sheetSequences {
+		if selected != nil && !selected[sheetIndex] {
+			continue
+		}
+		if skip[sheetIndex] {
+			// the material doesn't depend on the texture, so it can change independently
+			writeVMT(sheetIndex)
+
+			continue
+		}
+
 		sort.Slice(sequences, func(i, j int) bool {
-			ii := sequenceAddedInUpdate[sequences[i].name]
-			jj := sequenceAddedInUpdate[sequences[j].name]
-			if ii != jj {
-				return ii < jj
+			return sequenceLess(sequences[i].name, sequences[j].name)
+		})
+
+		name, _ := sheetNames(sheetIndex)
+		contentKey, err := sheetContentKey(sheetIndex, sequences)
+		if err != nil {
+			panic(err)
+		}
+		if cache.sheetFresh(sheetIndex, func(e sheetCacheEntry) string { return e.ContentKey }, contentKey) {
+			fmt.Printf("%s is up to date\n", name)
+
+			writeVMT(sheetIndex)
+
+			cache.Sheets[name] = sheetCacheEntry{
+				InputKey:   sheetKeys[sheetIndex],
+				ContentKey: contentKey,
 			}
+			cache.save()
 
-			return sequences[i].name < sequences[j].name
-		})
+			continue
+		}
 
 		sequenceOrder := make([]int, len(sequences))
 		sortMethods := []func(i, j int) bool{
@@ -758,6 +971,7 @@ func main() {
 
 		var bestTexture *image.NRGBA
 		var bestSheetData []byte
+		var bestRects []image.Rectangle
 		bestSquareness, bestSize, bestTexSize := 1<<30, 1<<30, 1<<30
 
 		// this is the same (naive) algorithm that mksheet.exe uses, except:
@@ -769,7 +983,7 @@ func main() {
 					sequenceOrder[i] = i
 				}
 				sort.SliceStable(sequenceOrder, sortMethod)
-				tex, sheetData, width, height := packSheet(sequences, sequenceOrder, tryWidth, false, true)
+				tex, sheetData, rects, width, height := packSheet(sequences, sequenceOrder, tryWidth, false, true)
 				if tex == nil {
 					continue
 				}
@@ -784,8 +998,9 @@ func main() {
 				message := "discarding"
 
 				if texSize < bestTexSize || (texSize == bestTexSize && size < bestSize) || (texSize == bestTexSize && size == bestSize && squareness < bestSquareness) {
-					bestTexture, _, _, _ = packSheet(sequences, sequenceOrder, tryWidth, true, true)
+					bestTexture, _, _, _, _ = packSheet(sequences, sequenceOrder, tryWidth, true, true)
 					bestSheetData = sheetData
+					bestRects = rects
 					bestSize = size
 					bestTexSize = texSize
 					bestSquareness = squareness
@@ -807,14 +1022,12 @@ func main() {
 
 		fmt.Println("writing files...")
 
-		name, enumName := "", ""
-		if sheetIndex < len(sheets) {
-			name, enumName = sheets[sheetIndex].name, sheets[sheetIndex].enum
-		} else {
-			name, enumName = additiveSheets[sheetIndex-len(sheets)].name, additiveSheets[sheetIndex-len(sheets)].enum
+		err = os.MkdirAll(*outputDir, 0755)
+		if err != nil {
+			panic(err)
 		}
 
-		out, err := os.Create(name + ".tga")
+		out, err := os.Create(outputPath(name + ".tga"))
 		if err != nil {
 			panic(err)
 		}
@@ -829,31 +1042,40 @@ func main() {
 			panic(err)
 		}
 
-		err = os.WriteFile(name+".sht", bestSheetData, 0644)
+		err = os.WriteFile(outputPath(name+".sht"), bestSheetData, 0644)
 		if err != nil {
 			panic(err)
 		}
 
-		enum, err := os.Create(name + "_enum.txt")
-		if err != nil {
-			panic(err)
+		names := make([]string, len(sequences))
+		for i, s := range sequences {
+			names[i] = s.name
 		}
 
-		fmt.Fprintf(enum, "\tDECLARE_HUD_SHEET( %s )\n", enumName)
-		for _, s := range sequences {
-			fmt.Fprintf(enum, "\t\tDECLARE_HUD_SHEET_UV( %s ),\n", s.name)
-		}
-		fmt.Fprintf(enum, "\tEND_HUD_SHEET( %s );\n", enumName)
+		writeSheetHeader(sheetIndex, names)
+		writeSheetManifest(sheetIndex, names, bestRects, bestTexture.Rect.Dx(), bestTexture.Rect.Dy())
 
-		err = enum.Close()
-		if err != nil {
-			panic(err)
+		if sheetIndex >= len(sheets) {
+			writeHoverTable(sheetIndex - len(sheets))
 		}
 
 		fmt.Println("compiling vtf...")
 
+		// vtex reads its settings from a text file next to the image
+		if *outputDir != "." {
+			settings, err := os.ReadFile(name + ".txt")
+			if err != nil {
+				panic(err)
+			}
+
+			err = os.WriteFile(outputPath(name+".txt"), settings, 0644)
+			if err != nil {
+				panic(err)
+			}
+		}
+
 		// sorry about the hard-coded path; I'm lazy
-		cmd := exec.Command(`D:\Program Files\Steam\steamapps\common\Alien Swarm Reactive Drop\bin\vtex.exe`, `-nopause`, `-nop4`, `-game`, `D:\Program Files\Steam\steamapps\common\Alien Swarm Reactive Drop\reactivedrop`, `-outdir`, `.`, name)
+		cmd := exec.Command(`D:\Program Files\Steam\steamapps\common\Alien Swarm Reactive Drop\bin\vtex.exe`, `-nopause`, `-nop4`, `-game`, `D:\Program Files\Steam\steamapps\common\Alien Swarm Reactive Drop\reactivedrop`, `-outdir`, *outputDir, outputPath(name))
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		err = cmd.Run()
@@ -861,17 +1083,251 @@ func main() {
 			panic(err)
 		}
 
+		writeVMT(sheetIndex)
+
+		cache.Sheets[name] = sheetCacheEntry{
+			InputKey:   sheetKeys[sheetIndex],
+			ContentKey: contentKey,
+		}
+		cache.save()
+
 		fmt.Print("\n\n")
 	}
 
 	fmt.Println("done!")
 }
 
-func readFrame(i int) (*image.NRGBA, error) {
-	name := fmt.Sprintf("mainmenu_%04d.png", i)
+// subtractBase turns an additive sequence's hovered crop (crop) and base crop
+// (crop2) into the difference between the two. If the hovered crop is from a
+// glow pass, it already is the difference, so only the base's alpha is used.
+//
+// The difference is denoised, confined to the area's mask if it has one, and
+// has the noise floor applied, and subtractBase returns true if nothing was left.
+func subtractBase(s *sequence, mask []float32) bool {
+	diff := newFloatImage(s.crop.Rect)
+	for o := 0; o < len(diff.Pix); o += 4 {
+		c0, c1 := s.crop.Pix[o:o+4], s.crop2.Pix[o:o+4]
+
+		// premultiplied base color to subtract
+		r1, g1, b1 := c1[0]*c1[3], c1[1]*c1[3], c1[2]*c1[3]
+		if s.glow {
+			r1, g1, b1 = 0, 0, 0
+		}
+
+		diff.Pix[o+0] = (c0[0]*c0[3] - r1) / 255
+		diff.Pix[o+1] = (c0[1]*c0[3] - g1) / 255
+		diff.Pix[o+2] = (c0[2]*c0[3] - b1) / 255
+		diff.Pix[o+3] = c1[3]
+	}
+
+	diff = denoiseDiff(diff, denoise, *denoiseRadius)
+	applyMask(diff, mask)
+	empty := applyNoiseFloor(diff, *noiseFloor)
+
+	if dither == ditherNone {
+		// keep the old truncating behavior when not dithering
+		for k := range diff.Pix {
+			diff.Pix[k] = float32(math.Floor(float64(diff.Pix[k])))
+		}
+	}
+
+	s.img = quantize(diff, dither)
+
+	return empty
+}
+
+// a file to read a crop from: either render frame index, or its glow pass
+type renderFile struct {
+	index int
+	glow  bool
+}
+
+// path is used in messages. The input directory can be an archive, so it
+// isn't necessarily a file on disk.
+func (f renderFile) path() string {
+	return filepath.Join(*inputDir, f.name())
+}
+
+// name returns the file name relative to the input directory.
+func (f renderFile) name() string {
+	if f.glow {
+		return patternName(*glowPattern, f.index)
+	}
+
+	return patternName(*inputPattern, f.index)
+}
+
+// stat looks the file up in the input directory.
+func (f renderFile) stat() (fs.FileInfo, error) {
+	src, err := openFrameSource(*inputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return src.stat(f.name())
+}
+
+// files returns the file along with the copies of it in -sample-dirs that exist.
+func (f renderFile) files() ([]sourceFile, error) {
+	var files []sourceFile
+	for i, dir := range append([]string{*inputDir}, sampleDirList()...) {
+		src, err := openFrameSource(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		file := sourceFile{src, dir, f.name()}
+		// a missing frame in the input directory is reported when it's read
+		if _, err := file.stat(); i == 0 || err == nil {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+func sampleDirList() []string {
+	if *sampleDirs == "" {
+		return nil
+	}
+
+	return strings.Split(*sampleDirs, ",")
+}
+
+// kind is used in messages and cache keys.
+func (f renderFile) kind() string {
+	if f.glow {
+		return "glow"
+	}
+
+	return "frame"
+}
+
+// sortRenderFiles sorts by frame, with each frame's glow pass after the frame.
+func sortRenderFiles(files []renderFile) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].index != files[j].index {
+			return files[i].index < files[j].index
+		}
+
+		return !files[i].glow && files[j].glow
+	})
+}
+
+// framePath returns the name of the file containing render frame i.
+func framePath(i int) string {
+	return renderFile{i, false}.path()
+}
+
+// glowPath returns the name of the file containing the glow pass for render frame i.
+func glowPath(i int) string {
+	return renderFile{i, true}.path()
+}
+
+// hasGlowPass returns true if render frame i should use a glow pass instead
+// of having the base frame subtracted from it.
+func hasGlowPass(i int) bool {
+	if *glowPattern == "" {
+		return false
+	}
+
+	_, err := renderFile{i, true}.stat()
+	return err == nil
+}
+
+func patternName(pattern string, i int) string {
+	if start := strings.IndexByte(pattern, '#'); start != -1 {
+		end := start
+		for end < len(pattern) && pattern[end] == '#' {
+			end++
+		}
+
+		pattern = strings.ReplaceAll(pattern[:start], "%", "%%") + fmt.Sprintf("%%0%dd", end-start) + strings.ReplaceAll(pattern[end:], "%", "%%")
+	}
+
+	return fmt.Sprintf(pattern, *startFrame+i)
+}
+
+func outputPath(name string) string {
+	return filepath.Join(*outputDir, name)
+}
+
+// readFrame reads a render frame or glow pass, averaging it with any copies in -sample-dirs.
+func readFrame(rf renderFile) (*floatImage, error) {
+	files, err := rf.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 1 {
+		return readFrameFile(files[0], rf.glow)
+	}
+
+	var sum *floatImage
+	for _, file := range files {
+		img, err := readFrameFile(file, rf.glow)
+		if err != nil {
+			return nil, err
+		}
+
+		if sum == nil {
+			sum = newFloatImage(img.Rect)
+		} else if img.Rect != sum.Rect {
+			return nil, fmt.Errorf("%s is %v, but %s is %v", file.path(), img.Rect, files[0].path(), sum.Rect)
+		}
+
+		// premultiplied, so transparent pixels don't contribute any color
+		for i := 0; i < len(sum.Pix); i += 4 {
+			a := img.Pix[i+3]
+			sum.Pix[i+0] += img.Pix[i+0] * a / 255
+			sum.Pix[i+1] += img.Pix[i+1] * a / 255
+			sum.Pix[i+2] += img.Pix[i+2] * a / 255
+			sum.Pix[i+3] += a
+		}
+	}
+
+	for i := 0; i < len(sum.Pix); i += 4 {
+		if sum.Pix[i+3] != 0 {
+			for c := 0; c < 3; c++ {
+				sum.Pix[i+c] *= 255 / sum.Pix[i+3]
+			}
+		}
+		sum.Pix[i+3] /= float32(len(files))
+	}
+
+	// the average has more precision than a single render, which is kept until
+	// the sequences are quantized
+	return sum, nil
+}
+
+func readFrameFile(file sourceFile, glow bool) (*floatImage, error) {
+	name := file.path()
 	fmt.Printf("reading %q\n", name)
 
-	f, err := os.Open(name)
+	if strings.EqualFold(filepath.Ext(name), ".exr") {
+		b, err := file.readAll()
+		if err != nil {
+			return nil, err
+		}
+
+		img, err := decodeEXR(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		layer := *exrLayer
+		if glow {
+			layer = *glowLayer
+		}
+
+		f, err := exrToFloat(img, layer)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		return f, nil
+	}
+
+	f, err := file.open()
 	if err != nil {
 		return nil, err
 	}
@@ -879,13 +1335,20 @@ func readFrame(i int) (*image.NRGBA, error) {
 
 	img, err := png.Decode(f)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
-	return img.(*image.NRGBA), nil
+	// Blender writes RGBA renders as NRGBA, but passes can be saved without alpha
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Rect, img, img.Bounds().Min, draw.Src)
+	}
+
+	return nrgbaToFloat(nrgba), nil
 }
 
-func packSheet(sequences []sequence, sequenceOrder []int, width int, copyPixels, transparent bool) (*image.NRGBA, []byte, int, int) {
+func packSheet(sequences []sequence, sequenceOrder []int, width int, copyPixels, transparent bool) (*image.NRGBA, []byte, []image.Rectangle, int, int) {
 	const padding = 8
 	offsets := make([]image.Point, len(sequences))
 	row, col, nextRow, maxCol := 0, 0, 0, 0
@@ -898,7 +1361,7 @@ func packSheet(sequences []sequence, sequenceOrder []int, width int, copyPixels,
 		}
 
 		if col+seq.img.Rect.Dx() > width {
-			return nil, nil, 0, 0
+			return nil, nil, nil, 0, 0
 		}
 
 		offsets[i].X = col
@@ -929,9 +1392,11 @@ func packSheet(sequences []sequence, sequenceOrder []int, width int, copyPixels,
 	sheetData := appendInt(nil, 1) // format version number
 	sheetData = appendInt(sheetData, uint32(len(sequences)))
 
+	rects := make([]image.Rectangle, len(sequences))
 	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
 	for i, seq := range sequences {
 		rect := seq.img.Rect.Add(offsets[i])
+		rects[i] = rect
 		if copyPixels {
 			for offset := padding / 2; offset > 0; offset-- {
 				draw.Draw(dst, rect.Add(image.Pt(offset, offset)), seq.img, image.Point{}, draw.Src)
@@ -957,11 +1422,11 @@ func packSheet(sequences []sequence, sequenceOrder []int, width int, copyPixels,
 		sheetData = appendFloat(sheetData, 1) // first (and only) frame time
 
 		// each color channel has a separate UV rectangle, but we are using RGBA so they're all the same
+		uv := sheetUV(rect, w, h)
 		for j := 0; j < 4; j++ {
-			sheetData = appendFloat(sheetData, (float32(rect.Min.X)+0.5)/float32(w))
-			sheetData = appendFloat(sheetData, (float32(rect.Min.Y)+0.5)/float32(h))
-			sheetData = appendFloat(sheetData, (float32(rect.Max.X)-0.5)/float32(w))
-			sheetData = appendFloat(sheetData, (float32(rect.Max.Y)-0.5)/float32(h))
+			for _, f := range uv {
+				sheetData = appendFloat(sheetData, f)
+			}
 		}
 	}
 
@@ -977,7 +1442,17 @@ func packSheet(sequences []sequence, sequenceOrder []int, width int, copyPixels,
 		}
 	}
 
-	return dst, sheetData, maxCol, nextRow
+	return dst, sheetData, rects, maxCol, nextRow
+}
+
+// sheetUV returns the texture coordinates (u0, v0, u1, v1) of the centers of the corner pixels of rect.
+func sheetUV(rect image.Rectangle, w, h int) [4]float32 {
+	return [4]float32{
+		(float32(rect.Min.X) + 0.5) / float32(w),
+		(float32(rect.Min.Y) + 0.5) / float32(h),
+		(float32(rect.Max.X) - 0.5) / float32(w),
+		(float32(rect.Max.Y) - 0.5) / float32(h),
+	}
 }
 
 func appendInt(b []byte, i uint32) []byte {
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type tonemapMethod int
+
+const (
+	tonemapClamp tonemapMethod = iota
+	tonemapReinhard
+	tonemapACES
+)
+
+func (m tonemapMethod) String() string {
+	switch m {
+	case tonemapClamp:
+		return "clamp"
+	case tonemapReinhard:
+		return "reinhard"
+	case tonemapACES:
+		return "aces"
+	}
+
+	return fmt.Sprintf("tonemapMethod(%d)", int(m))
+}
+
+func (m *tonemapMethod) Set(s string) error {
+	switch s {
+	case "clamp", "none", "standard":
+		*m = tonemapClamp
+	case "reinhard":
+		*m = tonemapReinhard
+	case "aces", "filmic":
+		*m = tonemapACES
+	default:
+		return fmt.Errorf("unknown tonemap method %q (expected clamp, reinhard, or aces)", s)
+	}
+
+	return nil
+}
+
+// apply maps a linear value, which can be above 1, into [0, 1].
+func (m tonemapMethod) apply(v float64) float64 {
+	switch m {
+	case tonemapReinhard:
+		v = v / (1 + v)
+	case tonemapACES:
+		// Krzysztof Narkowicz's fit of the ACES filmic curve
+		v = v * (2.51*v + 0.03) / (v*(2.43*v+0.59) + 0.14)
+	}
+
+	return math.Max(0, math.Min(1, v))
+}
+
+// linearToSRGB applies the sRGB transfer function, which is what Blender's
+// standard view transform does to the PNG frames.
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// exrToFloat tonemaps the channels with the given layer prefix (such as
+// ViewLayer.Combined, or "" for plain R, G, B, and A channels) into an image
+// like the ones Blender would have saved as PNG. The values aren't rounded, so
+// that subtractBase and quantize are the only things that lose precision.
+func exrToFloat(img *exrImage, layer string) (*floatImage, error) {
+	prefix := layer
+	if prefix != "" {
+		prefix += "."
+	}
+
+	var rgb [3][]float32
+	for i, c := range [...]string{"R", "G", "B"} {
+		rgb[i] = img.Channels[prefix+c]
+		if rgb[i] == nil {
+			return nil, fmt.Errorf("no %s%s channel (the layers in the file are: %s)", prefix, c, strings.Join(img.layers(), ", "))
+		}
+	}
+	// passes like Emit have no alpha
+	alpha := img.Channels[prefix+"A"]
+
+	scale := math.Exp2(*exposure)
+	out := newFloatImage(img.Rect)
+	for i := range rgb[0] {
+		a := 1.0
+		if alpha != nil {
+			a = math.Max(0, math.Min(1, float64(alpha[i])))
+		}
+
+		o := i * 4
+		for c := range rgb {
+			v := float64(rgb[c][i])
+			if a == 0 {
+				v = 0
+			} else {
+				// OpenEXR colors are premultiplied
+				v /= a
+			}
+
+			out.Pix[o+c] = float32(255 * linearToSRGB(tonemap.apply(v*scale)))
+		}
+		out.Pix[o+3] = float32(255 * a)
+	}
+
+	return out, nil
+}
+
+// layers returns the channel name prefixes in the image, with "" for unprefixed channels.
+func (img *exrImage) layers() []string {
+	seen := make(map[string]bool)
+	for name := range img.Channels {
+		layer := ""
+		if i := strings.LastIndexByte(name, '.'); i != -1 {
+			layer = name[:i]
+		}
+		seen[layer] = true
+	}
+
+	layers := make([]string, 0, len(seen))
+	for layer := range seen {
+		layers = append(layers, fmt.Sprintf("%q", layer))
+	}
+	sort.Strings(layers)
+
+	return layers
+}
+
+// usesEXR returns true if any of the input file patterns are OpenEXR files.
+func usesEXR() bool {
+	for _, pattern := range [...]string{*inputPattern, *glowPattern} {
+		if strings.EqualFold(filepath.Ext(pattern), ".exr") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// validateLayout checks the layout tables for mistakes that would otherwise
+// crash the build halfway through or produce a broken sheet.
+//
+// Frames are only checked for the sheets whose indices are true in selected,
+// or for every sheet if selected is nil. The render files are only required to
+// exist if checkFiles is true.
+func validateLayout(selected []bool, checkFiles bool) []string {
+	var problems []string
+	report := func(sheetIndex int, format string, args ...interface{}) {
+		name, _ := sheetNames(sheetIndex)
+		problems = append(problems, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	checkRect := func(sheetIndex int, name string, rect image.Rectangle) {
+		if rect.Empty() {
+			report(sheetIndex, "area %s is empty (%v)", name, rect)
+		} else if !rect.In(frameBounds) {
+			report(sheetIndex, "area %s (%v) is outside of the frame bounds (%v)", name, rect, frameBounds)
+		}
+	}
+
+	// every instance of a repeated area shares the same sequences, so they must all be the same size
+	checkSize := func(sheetIndex int, sizes map[string]image.Point, name string, rect image.Rectangle) {
+		if size, ok := sizes[name]; !ok {
+			sizes[name] = rect.Size()
+		} else if size != rect.Size() {
+			report(sheetIndex, "area %s is %v, but another area with the same name is %v", name, rect.Size(), size)
+		}
+	}
+
+	frameUses := make(map[int][]string)
+	checkFrame := func(sheetIndex, index int, sequence string) {
+		if selected != nil && !selected[sheetIndex] {
+			return
+		}
+
+		name, _ := sheetNames(sheetIndex)
+		frameUses[index] = append(frameUses[index], name+"/"+sequence)
+	}
+
+	checkMember := func(sheetIndex int, name string, member, count int) {
+		if member < 1 || member > count {
+			report(sheetIndex, "group %s has %d members, so it has no member %d", name, count, member)
+		}
+	}
+
+	for i, s := range sheets {
+		for _, g := range s.groups {
+			checkMember(i, g.name, g.source, len(g.rects))
+		}
+	}
+
+	for i, s := range additiveSheets {
+		for _, g := range s.groups {
+			for _, m := range g.members() {
+				checkMember(len(sheets)+i, g.name, m, len(g.rects))
+			}
+			for _, f := range g.indexed {
+				for _, m := range f.members {
+					checkMember(len(sheets)+i, g.name, m, len(g.rects))
+				}
+			}
+		}
+	}
+
+	for i, s := range sheets {
+		sizes := make(map[string]image.Point)
+		for _, a := range s.areas {
+			checkRect(i, a.name, a.rect)
+			checkSize(i, sizes, a.name, a.rect)
+			for _, f := range a.frames {
+				checkFrame(i, frameNumber(f.render), a.name+f.suffix)
+			}
+		}
+	}
+
+	for i, s := range additiveSheets {
+		sizes := make(map[string]image.Point)
+		for _, a := range s.areas {
+			checkRect(len(sheets)+i, a.name, a.rect)
+			checkSize(len(sheets)+i, sizes, a.name, a.rect)
+			for _, f := range a.frames {
+				checkFrame(len(sheets)+i, frameNumber(f.base), a.name+f.suffix)
+				checkFrame(len(sheets)+i, frameNumber(f.render), a.name+f.suffix)
+			}
+
+			// the overlay is drawn on top of the base sequence for the same area
+			for j, base := range sheets {
+				for _, b := range base.areas {
+					if b.name == a.name && b.rect.Size() != a.rect.Size() {
+						report(len(sheets)+i, "area %s is %v, but the area with the same name in %s is %v", a.name, a.rect.Size(), sheets[j].name, b.rect.Size())
+						break
+					}
+				}
+			}
+		}
+	}
+
+	masked := make(map[string]bool)
+	for i, s := range additiveSheets {
+		for _, id := range areaInstanceIDs(s.areas) {
+			if poly, ok := additiveMasks[id]; ok {
+				masked[id] = true
+				if len(poly) < 3 {
+					report(len(sheets)+i, "the mask polygon for area %s has %d points, but needs at least 3", id, len(poly))
+				}
+			}
+		}
+	}
+	ids := make([]string, 0, len(additiveMasks))
+	for id := range additiveMasks {
+		if !masked[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		problems = append(problems, fmt.Sprintf("there is a mask polygon for area %s, but no additive area has that instance ID", id))
+	}
+
+	for i := 0; i < len(sheets)+len(additiveSheets); i++ {
+		if _, enumName := sheetNames(i); !validIdentifier(enumName) {
+			report(i, "enum name %q is not a valid C identifier", enumName)
+		}
+
+		seen := make(map[string]bool)
+		for j, q := range requestFrames()[i] {
+			// additive sequences are requested twice (base frame and hover frame)
+			if i >= len(sheets) && j%2 == 1 {
+				continue
+			}
+
+			if !validIdentifier(q.name) {
+				report(i, "sequence name %q is not a valid C identifier", q.name)
+			}
+			if seen[q.name] {
+				report(i, "sequence name %q is used more than once", q.name)
+			}
+			seen[q.name] = true
+		}
+	}
+
+	indices := make([]int, 0, len(frameUses))
+	for index := range frameUses {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	for _, index := range indices {
+		if index < 0 {
+			problems = append(problems, fmt.Sprintf("frame %d (used by %v) is negative", index, frameUses[index]))
+			continue
+		}
+		if !checkFiles {
+			continue
+		}
+
+		fi, err := renderFile{index, false}.stat()
+		if err == nil && fi.Mode().IsRegular() {
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("%s is not a file", framePath(index))
+		}
+
+		problems = append(problems, fmt.Sprintf("frame %d (used by %v) cannot be read: %v", index, frameUses[index], err))
+	}
+
+	return problems
+}
+
+func validIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, c := range s {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i != 0 && c >= '0' && c <= '9') {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// writeVMT writes a VGUI material for a sheet.
+//
+// Base sheets are alpha blended, so they need $translucent and $vertexalpha
+// (so the panel alpha fades them). Additive sheets store the difference
+// between the hovered and unhovered renders, which has to be added to what is
+// already on the screen as-is; those are faded with the vertex color instead,
+// so they must not have $vertexalpha or $translucent.
+func writeVMT(sheetIndex int) {
+	name, _ := sheetNames(sheetIndex)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\"UnlitGeneric\"\n{\n")
+	fmt.Fprintf(&b, "\t\"$basetexture\" %q\n", path.Join(*materialPath, name))
+	if sheetIndex < len(sheets) {
+		fmt.Fprintf(&b, "\t\"$translucent\" \"1\"\n")
+		fmt.Fprintf(&b, "\t\"$vertexalpha\" \"1\"\n")
+	} else {
+		fmt.Fprintf(&b, "\t\"$additive\" \"1\"\n")
+	}
+	fmt.Fprintf(&b, "\t\"$vertexcolor\" \"1\"\n")
+	fmt.Fprintf(&b, "\t\"$ignorez\" \"1\"\n")
+	fmt.Fprintf(&b, "\t\"$no_fullbright\" \"1\"\n")
+	fmt.Fprintf(&b, "}\n")
+
+	err := os.MkdirAll(vmtOutputDir(), 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.WriteFile(filepath.Join(vmtOutputDir(), name+".vmt"), []byte(b.String()), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func vmtOutputDir() string {
+	if *vmtDir == "" {
+		return *outputDir
+	}
+
+	return *vmtDir
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	vpkSignature    = 0x55aa1234
+	vpkDirArchive   = 0x7fff
+	vpkEntryEnd     = 0xffff
+	vpkMD5BlockSize = 1 << 20
+)
+
+type vpkFile struct {
+	// path inside the game directory, using forward slashes
+	path string
+	data []byte
+}
+
+type vpkEntry struct {
+	file    *vpkFile
+	archive uint16
+	offset  uint32
+}
+
+func packageCommand(args []string) {
+	fs := flag.NewFlagSet("package", flag.ExitOnError)
+	output := fs.String("o", "main_menu", "output file name, without _dir.vpk or .vpk")
+	version := fs.Int("version", 2, "VPK version (1 or 2)")
+	chunkSize := fs.Int64("chunk-size", 0, "maximum size of each numbered archive; 0 stores everything in a single file")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 || (*version != 1 && *version != 2) || *chunkSize < 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var files []vpkFile
+	for i := 0; i < len(sheets)+len(additiveSheets); i++ {
+		name, _ := sheetNames(i)
+		for _, src := range [...]string{outputPath(name + ".vtf"), filepath.Join(vmtOutputDir(), name+".vmt"), outputPath(name + ".sht")} {
+			data, err := os.ReadFile(src)
+			if err != nil {
+				panic(err)
+			}
+
+			files = append(files, vpkFile{
+				path: path.Join("materials", *materialPath, filepath.Base(src)),
+				data: data,
+			})
+		}
+	}
+
+	written, err := writeVPK(*output, files, *version, *chunkSize)
+	if err != nil {
+		panic(err)
+	}
+
+	// make sure what we wrote can be read back
+	contents, err := readVPK(written[0])
+	if err != nil {
+		panic(fmt.Errorf("reading back %s: %w", written[0], err))
+	}
+	for _, f := range files {
+		if !bytes.Equal(contents[f.path], f.data) {
+			panic(fmt.Errorf("reading back %s: contents of %s do not match", written[0], f.path))
+		}
+	}
+	if len(contents) != len(files) {
+		panic(fmt.Errorf("reading back %s: expected %d files, found %d", written[0], len(files), len(contents)))
+	}
+
+	for _, name := range written {
+		fmt.Printf("wrote %q\n", name)
+	}
+}
+
+// writeVPK writes files to a Valve pak file and returns the names of the files
+// it created, starting with the directory file.
+//
+// If chunkSize is 0, the file data is stored in the directory file itself and
+// the directory file is named base + ".vpk". Otherwise, the file data is split
+// into numbered archives (base + "_000.vpk", ...) of at most chunkSize bytes
+// each (unless a single file is bigger than that) and the directory file is
+// named base + "_dir.vpk".
+func writeVPK(base string, files []vpkFile, version int, chunkSize int64) ([]string, error) {
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported VPK version %d", version)
+	}
+
+	// the tree is grouped by extension, then directory
+	tree := make(map[string]map[string][]*vpkEntry)
+	var entries []*vpkEntry
+	for i := range files {
+		f := &files[i]
+		dir, file := path.Split(f.path)
+		dir = strings.TrimSuffix(dir, "/")
+		ext := path.Ext(file)
+		file = strings.TrimSuffix(file, ext)
+		ext = strings.TrimPrefix(ext, ".")
+		if dir == "" {
+			dir = " "
+		}
+		if ext == "" {
+			ext = " "
+		}
+
+		e := &vpkEntry{file: f}
+		if tree[ext] == nil {
+			tree[ext] = make(map[string][]*vpkEntry)
+		}
+		tree[ext][dir] = append(tree[ext][dir], e)
+		entries = append(entries, e)
+	}
+
+	// lay out the file data
+	var archives [][]byte
+	var embedded []byte
+	for _, e := range entries {
+		if chunkSize == 0 {
+			e.archive = vpkDirArchive
+			e.offset = uint32(len(embedded))
+			embedded = append(embedded, e.file.data...)
+			continue
+		}
+
+		if len(archives) == 0 || len(archives[len(archives)-1]) != 0 && int64(len(archives[len(archives)-1])+len(e.file.data)) > chunkSize {
+			archives = append(archives, nil)
+		}
+		e.archive = uint16(len(archives) - 1)
+		e.offset = uint32(len(archives[e.archive]))
+		archives[e.archive] = append(archives[e.archive], e.file.data...)
+	}
+
+	var treeData []byte
+	exts := sortedKeys(tree)
+	for _, ext := range exts {
+		treeData = append(append(treeData, ext...), 0)
+		for _, dir := range sortedKeys(tree[ext]) {
+			treeData = append(append(treeData, dir...), 0)
+			group := tree[ext][dir]
+			sort.Slice(group, func(i, j int) bool {
+				return group[i].file.path < group[j].file.path
+			})
+			for _, e := range group {
+				file := path.Base(e.file.path)
+				file = strings.TrimSuffix(file, path.Ext(file))
+				treeData = append(append(treeData, file...), 0)
+				treeData = binary.LittleEndian.AppendUint32(treeData, crc32.ChecksumIEEE(e.file.data))
+				treeData = binary.LittleEndian.AppendUint16(treeData, 0) // preload bytes
+				treeData = binary.LittleEndian.AppendUint16(treeData, e.archive)
+				treeData = binary.LittleEndian.AppendUint32(treeData, e.offset)
+				treeData = binary.LittleEndian.AppendUint32(treeData, uint32(len(e.file.data)))
+				treeData = binary.LittleEndian.AppendUint16(treeData, vpkEntryEnd)
+			}
+			treeData = append(treeData, 0)
+		}
+		treeData = append(treeData, 0)
+	}
+	treeData = append(treeData, 0)
+
+	var archiveMD5 []byte
+	if version == 2 {
+		for i, a := range archives {
+			for offset := 0; offset < len(a); offset += vpkMD5BlockSize {
+				end := offset + vpkMD5BlockSize
+				if end > len(a) {
+					end = len(a)
+				}
+				sum := md5.Sum(a[offset:end])
+				archiveMD5 = binary.LittleEndian.AppendUint32(archiveMD5, uint32(i))
+				archiveMD5 = binary.LittleEndian.AppendUint32(archiveMD5, uint32(offset))
+				archiveMD5 = binary.LittleEndian.AppendUint32(archiveMD5, uint32(end-offset))
+				archiveMD5 = append(archiveMD5, sum[:]...)
+			}
+		}
+	}
+
+	var dir []byte
+	dir = binary.LittleEndian.AppendUint32(dir, vpkSignature)
+	dir = binary.LittleEndian.AppendUint32(dir, uint32(version))
+	dir = binary.LittleEndian.AppendUint32(dir, uint32(len(treeData)))
+	if version == 2 {
+		dir = binary.LittleEndian.AppendUint32(dir, uint32(len(embedded)))
+		dir = binary.LittleEndian.AppendUint32(dir, uint32(len(archiveMD5)))
+		dir = binary.LittleEndian.AppendUint32(dir, 48) // other MD5 section
+		dir = binary.LittleEndian.AppendUint32(dir, 0)  // unsigned
+	}
+	dir = append(dir, treeData...)
+	dir = append(dir, embedded...)
+	if version == 2 {
+		dir = append(dir, archiveMD5...)
+		treeSum := md5.Sum(treeData)
+		archiveSum := md5.Sum(archiveMD5)
+		dir = append(dir, treeSum[:]...)
+		dir = append(dir, archiveSum[:]...)
+		wholeSum := md5.Sum(dir)
+		dir = append(dir, wholeSum[:]...)
+	}
+
+	dirName := base + ".vpk"
+	if chunkSize != 0 {
+		dirName = base + "_dir.vpk"
+	}
+
+	written := []string{dirName}
+	err := os.WriteFile(dirName, dir, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range archives {
+		name := fmt.Sprintf("%s_%03d.vpk", base, i)
+		err = os.WriteFile(name, a, 0644)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, name)
+	}
+
+	return written, nil
+}
+
+// readVPK reads every file in a Valve pak file, given the name of its directory file.
+func readVPK(name string) (map[string][]byte, error) {
+	dir, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dir) < 12 || binary.LittleEndian.Uint32(dir) != vpkSignature {
+		return nil, errors.New("not a VPK file")
+	}
+
+	version := binary.LittleEndian.Uint32(dir[4:])
+	treeSize := int(binary.LittleEndian.Uint32(dir[8:]))
+	headerSize := 12
+	switch version {
+	case 1:
+	case 2:
+		headerSize = 28
+		if len(dir) < headerSize {
+			return nil, errors.New("truncated header")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported VPK version %d", version)
+	}
+
+	if len(dir) < headerSize+treeSize {
+		return nil, errors.New("truncated directory tree")
+	}
+	treeData := dir[headerSize : headerSize+treeSize]
+	dataStart := headerSize + treeSize
+
+	if version == 2 {
+		fileDataSize := int(binary.LittleEndian.Uint32(dir[12:]))
+		archiveMD5Size := int(binary.LittleEndian.Uint32(dir[16:]))
+		otherMD5Size := int(binary.LittleEndian.Uint32(dir[20:]))
+		if otherMD5Size == 48 {
+			sums := dataStart + fileDataSize + archiveMD5Size
+			if len(dir) < sums+48 {
+				return nil, errors.New("truncated checksums")
+			}
+			if treeSum := md5.Sum(treeData); !bytes.Equal(treeSum[:], dir[sums:sums+16]) {
+				return nil, errors.New("directory tree checksum mismatch")
+			}
+			if wholeSum := md5.Sum(dir[:sums+32]); !bytes.Equal(wholeSum[:], dir[sums+32:sums+48]) {
+				return nil, errors.New("whole file checksum mismatch")
+			}
+		}
+	}
+
+	archivePrefix := strings.TrimSuffix(name, "_dir.vpk")
+	archives := make(map[uint16][]byte)
+
+	r := bufio.NewReader(bytes.NewReader(treeData))
+	readString := func() (string, error) {
+		s, err := r.ReadString(0)
+		return strings.TrimSuffix(s, "\x00"), err
+	}
+
+	contents := make(map[string][]byte)
+	for {
+		ext, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		if ext == "" {
+			break
+		}
+
+		for {
+			dirName, err := readString()
+			if err != nil {
+				return nil, err
+			}
+			if dirName == "" {
+				break
+			}
+
+			for {
+				file, err := readString()
+				if err != nil {
+					return nil, err
+				}
+				if file == "" {
+					break
+				}
+
+				var entry struct {
+					CRC          uint32
+					PreloadBytes uint16
+					ArchiveIndex uint16
+					EntryOffset  uint32
+					EntryLength  uint32
+					Terminator   uint16
+				}
+				err = binary.Read(r, binary.LittleEndian, &entry)
+				if err != nil {
+					return nil, err
+				}
+				if entry.Terminator != vpkEntryEnd {
+					return nil, fmt.Errorf("bad entry terminator for %s", file)
+				}
+
+				data := make([]byte, int(entry.PreloadBytes), int(entry.PreloadBytes)+int(entry.EntryLength))
+				_, err = io.ReadFull(r, data)
+				if err != nil {
+					return nil, err
+				}
+
+				var archive []byte
+				offset := int(entry.EntryOffset)
+				if entry.ArchiveIndex == vpkDirArchive {
+					archive = dir
+					offset += dataStart
+				} else {
+					if archives[entry.ArchiveIndex] == nil {
+						archives[entry.ArchiveIndex], err = os.ReadFile(fmt.Sprintf("%s_%03d.vpk", archivePrefix, entry.ArchiveIndex))
+						if err != nil {
+							return nil, err
+						}
+					}
+					archive = archives[entry.ArchiveIndex]
+				}
+				if offset+int(entry.EntryLength) > len(archive) {
+					return nil, fmt.Errorf("data for %s is out of range", file)
+				}
+				data = append(data, archive[offset:offset+int(entry.EntryLength)]...)
+
+				if crc32.ChecksumIEEE(data) != entry.CRC {
+					return nil, fmt.Errorf("CRC mismatch for %s", file)
+				}
+
+				fullName := file
+				if ext != " " {
+					fullName += "." + ext
+				}
+				if dirName != " " {
+					fullName = dirName + "/" + fullName
+				}
+				contents[fullName] = data
+			}
+		}
+	}
+
+	return contents, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
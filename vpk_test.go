@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteVPK(t *testing.T) {
+	files := []vpkFile{
+		{"materials/vgui/swarm/main_menu_sheet.vtf", bytes.Repeat([]byte("vtf"), 50)},
+		{"materials/vgui/swarm/main_menu_sheet.vmt", []byte(`"UnlitGeneric" {}`)},
+		{"materials/vgui/swarm/main_menu_sheet.sht", bytes.Repeat([]byte{0, 1, 2, 3, 4}, 13)},
+		{"materials/vgui/swarm/main_menu_additive_sheet.vtf", bytes.Repeat([]byte{0xff}, 250)},
+		{"materials/vgui/main_menu.txt", []byte("a different directory")},
+		{"scripts/README", []byte("no extension")},
+		{"empty.txt", nil},
+	}
+
+	for _, version := range []int{1, 2} {
+		for _, chunkSize := range []int64{0, 100} {
+			t.Run(fmt.Sprintf("v%d chunk %d", version, chunkSize), func(t *testing.T) {
+				base := filepath.Join(t.TempDir(), "main_menu")
+				written, err := writeVPK(base, files, version, chunkSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if chunkSize == 0 {
+					if len(written) != 1 || written[0] != base+".vpk" {
+						t.Errorf("wrote %q, want only %q", written, base+".vpk")
+					}
+				} else {
+					if len(written) < 3 || written[0] != base+"_dir.vpk" {
+						t.Errorf("wrote %q, want %q and at least two numbered archives", written, base+"_dir.vpk")
+					}
+					for i, name := range written[1:] {
+						if name != fmt.Sprintf("%s_%03d.vpk", base, i) {
+							t.Errorf("archive %d is named %q", i, name)
+						}
+					}
+				}
+
+				contents := readTestVPK(t, written[0], base, version, chunkSize)
+				if len(contents) != len(files) {
+					t.Errorf("found %d files, want %d", len(contents), len(files))
+				}
+				for _, f := range files {
+					data, ok := contents[f.path]
+					if !ok {
+						t.Errorf("%s is missing", f.path)
+					} else if !bytes.Equal(data, f.data) {
+						t.Errorf("%s is %q, want %q", f.path, data, f.data)
+					}
+				}
+			})
+		}
+	}
+}
+
+// readTestVPK reads a VPK directory file straight from the format
+// description, without using readVPK, and checks every checksum in it.
+func readTestVPK(t *testing.T, name, base string, version int, chunkSize int64) map[string][]byte {
+	t.Helper()
+
+	dir, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize := 12
+	if version == 2 {
+		headerSize = 28
+	}
+	header := make([]uint32, headerSize/4)
+	if err := binary.Read(bytes.NewReader(dir), binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+
+	if header[0] != 0x55aa1234 {
+		t.Fatalf("signature is %#x", header[0])
+	}
+	if header[1] != uint32(version) {
+		t.Fatalf("version is %d, want %d", header[1], version)
+	}
+
+	tree := dir[headerSize : headerSize+int(header[2])]
+	dataStart := headerSize + len(tree)
+
+	archives := make(map[uint16][]byte)
+	archive := func(index uint16) []byte {
+		if index == 0x7fff {
+			if chunkSize != 0 {
+				t.Errorf("file stored in the directory file, but chunk size is %d", chunkSize)
+			}
+			return dir[dataStart:]
+		}
+
+		if chunkSize == 0 {
+			t.Errorf("file stored in archive %d, but chunk size is 0", index)
+		}
+		if archives[index] == nil {
+			archives[index], err = os.ReadFile(fmt.Sprintf("%s_%03d.vpk", base, index))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return archives[index]
+	}
+
+	contents := make(map[string][]byte)
+	filesIn := make(map[uint16]int)
+	embedded := 0
+	for _, e := range parseTestVPKTree(t, tree) {
+		a := archive(e.index)
+		if e.offset+e.length > len(a) {
+			t.Fatalf("%s is at %d+%d, past the end of archive %#x", e.path, e.offset, e.length, e.index)
+		}
+		data := append(append([]byte(nil), e.preload...), a[e.offset:e.offset+e.length]...)
+		filesIn[e.index]++
+		if e.index == 0x7fff {
+			embedded += e.length
+		}
+
+		if got := crc32.ChecksumIEEE(data); got != e.crc {
+			t.Errorf("%s has CRC %#08x, but the tree says %#08x", e.path, got, e.crc)
+		}
+
+		if _, ok := contents[e.path]; ok {
+			t.Errorf("%s is in the tree twice", e.path)
+		}
+		contents[e.path] = data
+	}
+	for index, a := range archives {
+		// only a single file bigger than the chunk size can make an archive bigger than that
+		if int64(len(a)) > chunkSize && filesIn[index] != 1 {
+			t.Errorf("archive %d has %d files in %d bytes, more than the chunk size", index, filesIn[index], len(a))
+		}
+	}
+
+	if version == 1 {
+		if len(dir) != dataStart+embedded {
+			t.Errorf("directory file is %d bytes, want %d", len(dir), dataStart+embedded)
+		}
+		return contents
+	}
+
+	// version 2 adds the sizes of the sections after the tree
+	fileDataSize, archiveMD5Size, otherMD5Size, signatureSize := header[3], header[4], header[5], header[6]
+	if int(fileDataSize) != embedded {
+		t.Errorf("file data section is %d bytes, want %d", fileDataSize, embedded)
+	}
+	if otherMD5Size != 48 {
+		t.Fatalf("other MD5 section is %d bytes, want 48", otherMD5Size)
+	}
+	if signatureSize != 0 {
+		t.Errorf("signature section is %d bytes, want 0", signatureSize)
+	}
+
+	archiveMD5Start := dataStart + int(fileDataSize)
+	otherMD5Start := archiveMD5Start + int(archiveMD5Size)
+	if len(dir) != otherMD5Start+48 {
+		t.Fatalf("directory file is %d bytes, want %d", len(dir), otherMD5Start+48)
+	}
+	archiveMD5 := dir[archiveMD5Start:otherMD5Start]
+
+	// each archive MD5 entry is the archive index, offset, length, and checksum of up to 1MiB of it
+	covered := make(map[uint16]int)
+	if len(archiveMD5)%28 != 0 {
+		t.Fatalf("archive MD5 section is %d bytes, not a multiple of 28", len(archiveMD5))
+	}
+	for i := 0; i < len(archiveMD5); i += 28 {
+		index := uint16(binary.LittleEndian.Uint32(archiveMD5[i:]))
+		offset := int(binary.LittleEndian.Uint32(archiveMD5[i+4:]))
+		length := int(binary.LittleEndian.Uint32(archiveMD5[i+8:]))
+		a := archive(index)
+		if offset != covered[index] || offset+length > len(a) {
+			t.Errorf("archive MD5 entry %d covers %d+%d of archive %d, which is %d bytes and covered up to %d", i/28, offset, length, index, len(a), covered[index])
+			continue
+		}
+		covered[index] = offset + length
+
+		if sum := md5.Sum(a[offset : offset+length]); !bytes.Equal(sum[:], archiveMD5[i+12:i+28]) {
+			t.Errorf("archive MD5 entry %d does not match archive %d", i/28, index)
+		}
+	}
+	for index, a := range archives {
+		if covered[index] != len(a) {
+			t.Errorf("archive MD5 section covers %d of %d bytes of archive %d", covered[index], len(a), index)
+		}
+	}
+
+	other := dir[otherMD5Start:]
+	if sum := md5.Sum(tree); !bytes.Equal(sum[:], other[0:16]) {
+		t.Errorf("tree MD5 does not match")
+	}
+	if sum := md5.Sum(archiveMD5); !bytes.Equal(sum[:], other[16:32]) {
+		t.Errorf("archive MD5 section MD5 does not match")
+	}
+	if sum := md5.Sum(dir[:otherMD5Start+32]); !bytes.Equal(sum[:], other[32:48]) {
+		t.Errorf("whole file MD5 does not match")
+	}
+
+	if strings.HasSuffix(name, "_dir.vpk") != (chunkSize != 0) {
+		t.Errorf("directory file is named %s with chunk size %d", name, chunkSize)
+	}
+
+	return contents
+}
+
+type testVPKEntry struct {
+	path    string
+	crc     uint32
+	preload []byte
+	index   uint16
+	offset  int
+	length  int
+}
+
+// parseTestVPKTree lists the entries in a VPK directory tree, in the order they are written.
+func parseTestVPKTree(t *testing.T, tree []byte) []testVPKEntry {
+	t.Helper()
+
+	// the tree is a list of extensions, each with a list of directories,
+	// each with a list of files, all ending with an empty string
+	pos := 0
+	str := func() string {
+		end := bytes.IndexByte(tree[pos:], 0)
+		if end == -1 {
+			t.Fatalf("unterminated string at %d in the directory tree", pos)
+		}
+		s := string(tree[pos : pos+end])
+		pos += end + 1
+		return s
+	}
+
+	var entries []testVPKEntry
+	for ext := str(); ext != ""; ext = str() {
+		for dirName := str(); dirName != ""; dirName = str() {
+			for file := str(); file != ""; file = str() {
+				if pos+18 > len(tree) {
+					t.Fatalf("truncated entry for %s", file)
+				}
+				e := testVPKEntry{
+					crc:    binary.LittleEndian.Uint32(tree[pos:]),
+					index:  binary.LittleEndian.Uint16(tree[pos+6:]),
+					offset: int(binary.LittleEndian.Uint32(tree[pos+8:])),
+					length: int(binary.LittleEndian.Uint32(tree[pos+12:])),
+				}
+				preload := int(binary.LittleEndian.Uint16(tree[pos+4:]))
+				if end := binary.LittleEndian.Uint16(tree[pos+16:]); end != 0xffff {
+					t.Errorf("entry for %s ends with %#x", file, end)
+				}
+				pos += 18
+
+				if pos+preload > len(tree) {
+					t.Fatalf("truncated preload data for %s", file)
+				}
+				e.preload = tree[pos : pos+preload]
+				pos += preload
+
+				e.path = file
+				if ext != " " {
+					e.path += "." + ext
+				}
+				if dirName != " " {
+					e.path = dirName + "/" + e.path
+				}
+				entries = append(entries, e)
+			}
+		}
+	}
+	if pos != len(tree) {
+		t.Errorf("directory tree is %d bytes, but only %d were used", len(tree), pos)
+	}
+
+	return entries
+}
+
+// TestWriteVPKMatchesReference compares the directory tree writeVPK makes for
+// the files in testdata/vpk/input with the one in testdata/vpk/input.vpk,
+// which is what Valve's vpk.exe makes when it is run on that directory. The
+// data can be laid out in any order, but the tree must list the same files
+// with the same checksums and sizes, in the same order.
+func TestWriteVPKMatchesReference(t *testing.T) {
+	reference, err := os.ReadFile(filepath.Join("testdata", "vpk", "input.vpk"))
+	if os.IsNotExist(err) {
+		t.Skip("testdata/vpk/input.vpk is missing; run vpk.exe on testdata/vpk/input to make it")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []vpkFile
+	root := filepath.Join("testdata", "vpk", "input")
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, vpkFile{filepath.ToSlash(rel), data})
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reference) < 12 || binary.LittleEndian.Uint32(reference) != 0x55aa1234 {
+		t.Fatal("the reference is not a VPK file")
+	}
+	version := int(binary.LittleEndian.Uint32(reference[4:]))
+	headerSize := map[int]int{1: 12, 2: 28}[version]
+	if headerSize == 0 {
+		t.Fatalf("the reference is VPK version %d", version)
+	}
+
+	written, err := writeVPK(filepath.Join(t.TempDir(), "input"), files, version, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, err := os.ReadFile(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := func(dir []byte) []testVPKEntry {
+		size := int(binary.LittleEndian.Uint32(dir[8:]))
+		return parseTestVPKTree(t, dir[headerSize:headerSize+size])
+	}
+	want, got := tree(reference), tree(ours)
+	if len(got) != len(want) {
+		t.Errorf("tree has %d files, but the reference has %d", len(got), len(want))
+	}
+	for i := 0; i < len(got) && i < len(want); i++ {
+		g, w := got[i], want[i]
+		if g.path != w.path || g.crc != w.crc || len(g.preload)+g.length != len(w.preload)+w.length || (g.index == 0x7fff) != (w.index == 0x7fff) {
+			t.Errorf("entry %d is %s (CRC %#08x, %d bytes, archive %#x), but the reference has %s (CRC %#08x, %d bytes, archive %#x)", i, g.path, g.crc, len(g.preload)+g.length, g.index, w.path, w.crc, len(w.preload)+w.length, w.index)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type watchedFile struct {
+	// sheets the file contributes to
+	sheets []int
+	// the layout has to be reloaded when the file changes
+	layout bool
+
+	size    int64
+	modTime time.Time
+	// when the file was last seen changing, or the zero time if it has not changed since it was last used
+	changed time.Time
+}
+
+// the last chunk of every PNG file; Blender writes it last, so a file without it is not finished yet
+var pngTrailer = []byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xae, 0x42, 0x60, 0x82}
+
+func watch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the rendered frames for changes")
+	settle := fs.Duration("settle", 2*time.Second, "how long a changed frame must stay the same before it is used")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	files, names := watchFiles(nil)
+
+	rebuild(nil)
+
+	log.Printf("watching %d files for changes", len(files))
+
+	for range time.Tick(*interval) {
+		now := time.Now()
+		selected := make([]bool, len(sheets)+len(additiveSheets))
+		var changed []string
+		reload := false
+
+		for _, name := range names {
+			f := files[name]
+
+			size, modTime := statWatched(name)
+			if size != f.size || !modTime.Equal(f.modTime) {
+				f.size, f.modTime, f.changed = size, modTime, now
+				continue
+			}
+
+			if f.changed.IsZero() || now.Sub(f.changed) < *settle {
+				continue
+			}
+
+			if size < 0 {
+				// deleted; wait for it to be rendered again
+				f.changed = time.Time{}
+				continue
+			}
+
+			if filepath.Ext(name) == ".png" && !pngComplete(name) {
+				continue
+			}
+
+			f.changed = time.Time{}
+			changed = append(changed, filepath.Base(name))
+			reload = reload || f.layout
+			for _, i := range f.sheets {
+				selected[i] = true
+			}
+		}
+
+		if len(changed) == 0 {
+			continue
+		}
+
+		log.Printf("changed: %s", strings.Join(changed, ", "))
+
+		if reload {
+			if err := loadLayout(); err != nil {
+				log.Printf("failed to reload layout: %v", err)
+				continue
+			}
+
+			// the layout can refer to different frames and masks now
+			count := len(files)
+			files, names = watchFiles(files)
+			if len(files) != count {
+				log.Printf("watching %d files for changes", len(files))
+			}
+		}
+
+		rebuild(selected)
+	}
+}
+
+// watchFiles returns the files to watch and their names in order. Files that
+// were already being watched keep their state, so their changes are neither
+// lost nor noticed twice.
+func watchFiles(old map[string]*watchedFile) (map[string]*watchedFile, []string) {
+	files := watchedFiles()
+	names := make([]string, 0, len(files))
+	for name, f := range files {
+		names = append(names, name)
+		if o, ok := old[name]; ok {
+			f.size, f.modTime, f.changed = o.size, o.modTime, o.changed
+		} else {
+			f.size, f.modTime = statWatched(name)
+		}
+	}
+	sort.Strings(names)
+
+	return files, names
+}
+
+// watchedFiles returns the input files along with the sheets they contribute to.
+func watchedFiles() map[string]*watchedFile {
+	files := make(map[string]*watchedFile)
+	add := func(name string, sheetIndex int) {
+		f, ok := files[name]
+		if !ok {
+			f = &watchedFile{}
+			files[name] = f
+		}
+
+		if len(f.sheets) == 0 || f.sheets[len(f.sheets)-1] != sheetIndex {
+			f.sheets = append(f.sheets, sheetIndex)
+		}
+	}
+	// copies in -sample-dirs are watched even if they don't exist, so adding one is noticed
+	addFrame := func(rf renderFile, sheetIndex int) {
+		for _, dir := range append([]string{*inputDir}, sampleDirList()...) {
+			if isArchive(dir) {
+				// any change to the archive could be to this frame
+				add(dir, sheetIndex)
+			} else {
+				add(filepath.Join(dir, rf.name()), sheetIndex)
+			}
+		}
+	}
+
+	for i, s := range sheets {
+		for _, a := range s.areas {
+			for _, f := range a.frames {
+				addFrame(renderFile{frameNumber(f.render), false}, i)
+			}
+		}
+	}
+	for i, s := range additiveSheets {
+		ids := areaInstanceIDs(s.areas)
+		for j, a := range s.areas {
+			if name := maskPath(ids[j]); name != "" {
+				// watched even if it doesn't exist, so adding one masks the area
+				add(name, len(sheets)+i)
+			}
+
+			for _, f := range a.frames {
+				addFrame(renderFile{frameNumber(f.base), false}, len(sheets)+i)
+				addFrame(renderFile{frameNumber(f.render), false}, len(sheets)+i)
+				if *glowPattern != "" {
+					// watched even if it doesn't exist, so adding one switches the sequence over to it
+					addFrame(renderFile{frameNumber(f.render), true}, len(sheets)+i)
+				}
+			}
+		}
+	}
+
+	// these can move any area or change any frame
+	for _, name := range [...]string{*frameMarkers, *blendLayout, *regionMap, *regionNames} {
+		if name == "" {
+			continue
+		}
+
+		f := &watchedFile{layout: true}
+		for i := 0; i < len(sheets)+len(additiveSheets); i++ {
+			f.sheets = append(f.sheets, i)
+		}
+		files[name] = f
+	}
+
+	return files
+}
+
+// statWatched returns a size of -1 if the file does not exist.
+func statWatched(name string) (int64, time.Time) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return -1, time.Time{}
+	}
+
+	return fi.Size(), fi.ModTime()
+}
+
+func pngComplete(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	trailer := make([]byte, len(pngTrailer))
+	if _, err = f.Seek(-int64(len(trailer)), io.SeekEnd); err != nil {
+		return false
+	}
+	if _, err = io.ReadFull(f, trailer); err != nil {
+		return false
+	}
+
+	return bytes.Equal(trailer, pngTrailer)
+}
+
+// rebuild is like buildSheets, but reports errors instead of exiting.
+func rebuild(selected []bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("build failed: %v", r)
+		}
+	}()
+
+	buildSheets(selected)
+}